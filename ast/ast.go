@@ -1,10 +1,21 @@
 package ast
 
-import "Butterfly/lexer"
+import (
+	"Butterfly/lexer"
+	"strconv"
+	"strings"
+)
 
 // 所有节点类型都必须实现 Node 接口
 type Node interface {
 	TokenLiteral() string
+	String() string // 调试用的源码形式，中缀表达式带完整括号
+}
+
+// 所有语句节点都必须实现 Statement 接口
+type Statement interface {
+	Node
+	statementNode()
 }
 
 // 所有表达式节点都必须实现 Expression 接口
@@ -13,12 +24,186 @@ type Expression interface {
 	expressionNode()
 }
 
-// Program 是每个 AST 的根节点
+// Program 是每个 AST 的根节点，由一系列语句组成
 type Program struct {
-	Expression Expression
+	Statements []Statement
 }
 
 func (p *Program) TokenLiteral() string { return "Program" }
+func (p *Program) String() string {
+	var out string
+	for _, s := range p.Statements {
+		out += s.String()
+	}
+	return out
+}
+
+// 表达式语句，如 1 + 2;
+type ExpressionStatement struct {
+	Token      lexer.Token // 表达式的第一个Token
+	Expression Expression
+}
+
+func (es *ExpressionStatement) statementNode()       {}
+func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Value }
+func (es *ExpressionStatement) String() string {
+	if es.Expression == nil {
+		return ""
+	}
+	return es.Expression.String()
+}
+
+// 变量声明语句，如 int x = 5;
+// 省略初始值时 Value 为 nil，变量初始化为 0
+type LetStatement struct {
+	Token lexer.Token // 类型关键字 int 或 char
+	Name  *Identifier
+	Value Expression
+}
+
+func (ls *LetStatement) statementNode()       {}
+func (ls *LetStatement) TokenLiteral() string { return ls.Token.Value }
+func (ls *LetStatement) String() string {
+	out := ls.TokenLiteral() + " " + ls.Name.String()
+	if ls.Value != nil {
+		out += " = " + ls.Value.String()
+	}
+	return out + ";"
+}
+
+// 语句块，如 { x = 1; y = 2; }
+type BlockStatement struct {
+	Token      lexer.Token // { 词法单元
+	Statements []Statement
+}
+
+func (bs *BlockStatement) statementNode()       {}
+func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Value }
+func (bs *BlockStatement) String() string {
+	out := "{"
+	for _, s := range bs.Statements {
+		out += s.String()
+	}
+	return out + "}"
+}
+
+// 条件语句，如 if (x > 0) { ... } else { ... }
+// 没有 else 分支时 Alternative 为 nil
+type IfStatement struct {
+	Token       lexer.Token // if 词法单元
+	Condition   Expression
+	Consequence *BlockStatement
+	Alternative *BlockStatement
+}
+
+func (is *IfStatement) statementNode()       {}
+func (is *IfStatement) TokenLiteral() string { return is.Token.Value }
+func (is *IfStatement) String() string {
+	out := "if " + is.Condition.String() + " " + is.Consequence.String()
+	if is.Alternative != nil {
+		out += " else " + is.Alternative.String()
+	}
+	return out
+}
+
+// 循环语句，如 while (i < 10) { i = i + 1; }
+type WhileStatement struct {
+	Token     lexer.Token // while 词法单元
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (ws *WhileStatement) statementNode()       {}
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Value }
+func (ws *WhileStatement) String() string {
+	return "while " + ws.Condition.String() + " " + ws.Body.String()
+}
+
+// for 循环语句，如 for (int i = 0; i < 10; i = i + 1) { ... }
+// 三个子句都可以省略，省略的子句为 nil；省略条件表示无限循环
+type ForStatement struct {
+	Token     lexer.Token // for 词法单元
+	Init      Statement
+	Condition Expression
+	Post      Expression
+	Body      *BlockStatement
+}
+
+func (fs *ForStatement) statementNode()       {}
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Value }
+func (fs *ForStatement) String() string {
+	out := "for ("
+	if fs.Init != nil {
+		out += strings.TrimSuffix(fs.Init.String(), ";")
+	}
+	out += "; "
+	if fs.Condition != nil {
+		out += fs.Condition.String()
+	}
+	out += "; "
+	if fs.Post != nil {
+		out += fs.Post.String()
+	}
+	return out + ") " + fs.Body.String()
+}
+
+// break 语句，跳出最内层循环
+type BreakStatement struct {
+	Token lexer.Token // break 词法单元
+}
+
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Value }
+func (bs *BreakStatement) String() string       { return "break;" }
+
+// continue 语句，结束最内层循环的本次迭代
+type ContinueStatement struct {
+	Token lexer.Token // continue 词法单元
+}
+
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Value }
+func (cs *ContinueStatement) String() string       { return "continue;" }
+
+// 输出语句，如 printf("x=%d\n", x);
+type PrintfStatement struct {
+	Token     lexer.Token // printf 词法单元
+	Format    Expression
+	Arguments []Expression
+}
+
+func (ps *PrintfStatement) statementNode()       {}
+func (ps *PrintfStatement) TokenLiteral() string { return ps.Token.Value }
+func (ps *PrintfStatement) String() string {
+	args := []string{ps.Format.String()}
+	for _, a := range ps.Arguments {
+		args = append(args, a.String())
+	}
+	return "printf(" + strings.Join(args, ", ") + ");"
+}
+
+// 标识符，如变量名 x
+type Identifier struct {
+	Token lexer.Token // a lexer.IDENTIFIER
+	Value string
+}
+
+func (i *Identifier) expressionNode()      {}
+func (i *Identifier) TokenLiteral() string { return i.Token.Value }
+func (i *Identifier) String() string       { return i.Value }
+
+// 赋值表达式，如 x = x + 1，其值为赋给变量的值
+type AssignExpression struct {
+	Token lexer.Token // = 词法单元
+	Name  *Identifier
+	Value Expression
+}
+
+func (ae *AssignExpression) expressionNode()      {}
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Value }
+func (ae *AssignExpression) String() string {
+	return "(" + ae.Name.String() + " = " + ae.Value.String() + ")"
+}
 
 // 整数リテラル
 type IntegerLiteral struct {
@@ -28,6 +213,74 @@ type IntegerLiteral struct {
 
 func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Value }
+func (il *IntegerLiteral) String() string       { return il.Token.Value }
+
+// 浮点数字面量
+type FloatLiteral struct {
+	Token lexer.Token // a lexer.FLOAT
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode()      {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Value }
+func (fl *FloatLiteral) String() string       { return fl.Token.Value }
+
+// 字符字面量，如 'a'，值为字符的码点
+type CharLiteral struct {
+	Token lexer.Token // a lexer.CharConst
+	Value rune
+}
+
+func (cl *CharLiteral) expressionNode()      {}
+func (cl *CharLiteral) TokenLiteral() string { return cl.Token.Value }
+func (cl *CharLiteral) String() string       { return "'" + cl.Token.Value + "'" }
+
+// 字符串字面量，如 "hello"
+type StringLiteral struct {
+	Token lexer.Token // a lexer.STRING
+	Value string
+}
+
+func (sl *StringLiteral) expressionNode()      {}
+func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Value }
+func (sl *StringLiteral) String() string       { return strconv.Quote(sl.Value) }
+
+// 布尔字面量 true / false
+type BooleanLiteral struct {
+	Token lexer.Token // a lexer.TRUE or lexer.FALSE
+	Value bool
+}
+
+func (bl *BooleanLiteral) expressionNode()      {}
+func (bl *BooleanLiteral) TokenLiteral() string { return bl.Token.Value }
+func (bl *BooleanLiteral) String() string       { return bl.Token.Value }
+
+// 前缀表达式，如 !x 或 -x
+type PrefixExpression struct {
+	Token    lexer.Token // 前缀运算符Token, e.g. !
+	Operator string
+	Right    Expression
+}
+
+func (pe *PrefixExpression) expressionNode()      {}
+func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Value }
+func (pe *PrefixExpression) String() string {
+	return "(" + pe.Operator + pe.Right.String() + ")"
+}
+
+// 类型转换表达式，如 (char)65 或 (int)'A'
+// int 和 char 在运行时都以整数存储，转换只改变表达式在源码中的类型
+type CastExpression struct {
+	Token lexer.Token // ( 词法单元
+	Type  lexer.Token // 目标类型关键字 int 或 char
+	Right Expression
+}
+
+func (ce *CastExpression) expressionNode()      {}
+func (ce *CastExpression) TokenLiteral() string { return ce.Token.Value }
+func (ce *CastExpression) String() string {
+	return "((" + ce.Type.Value + ")" + ce.Right.String() + ")"
+}
 
 // 中缀表达式，如 a + b 或 a - b
 type InfixExpression struct {
@@ -39,3 +292,6 @@ type InfixExpression struct {
 
 func (ie *InfixExpression) expressionNode()      {}
 func (ie *InfixExpression) TokenLiteral() string { return ie.Token.Value }
+func (ie *InfixExpression) String() string {
+	return "(" + ie.Left.String() + " " + ie.Operator + " " + ie.Right.String() + ")"
+}
@@ -0,0 +1,59 @@
+package compiler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// lookupOpcode 根据助记符查找操作码，与 Instructions.String() 的输出保持一致
+func lookupOpcode(name string) (Opcode, bool) {
+	for op, def := range definitions {
+		if def.Name == name {
+			return op, true
+		}
+	}
+	return 0, false
+}
+
+// Assemble 将文本形式的汇编（每行一条指令，如 "OpConstant 0"）解析为字节码
+// 行首可以带有 Instructions.String() 输出的偏移（如 "0003 OpAdd"），偏移会被忽略，
+// 因此反汇编的结果可以直接重新汇编
+func Assemble(text string) (Instructions, error) {
+	ins := Instructions{}
+	for n, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue // 忽略空行
+		}
+		if _, err := strconv.Atoi(fields[0]); err == nil {
+			fields = fields[1:] // 跳过行首的偏移
+			if len(fields) == 0 {
+				return nil, fmt.Errorf("line %d: missing opcode", n+1)
+			}
+		}
+
+		op, ok := lookupOpcode(fields[0])
+		if !ok {
+			return nil, fmt.Errorf("line %d: unknown opcode %q", n+1, fields[0])
+		}
+
+		widths := definitions[op].OperandWidths
+		want := len(widths)
+		if len(fields)-1 != want {
+			return nil, fmt.Errorf("line %d: %s expects %d operand(s), got %d", n+1, fields[0], want, len(fields)-1)
+		}
+
+		operands := make([]int, 0, want)
+		for i, f := range fields[1:] {
+			v, err := strconv.Atoi(f)
+			if err != nil || v < 0 || v >= 1<<(8*widths[i]) {
+				return nil, fmt.Errorf("line %d: invalid operand %q", n+1, f)
+			}
+			operands = append(operands, v)
+		}
+
+		ins = append(ins, Make(op, operands...)...)
+	}
+	return ins, nil
+}
@@ -7,35 +7,219 @@ type Instructions []byte
 type Opcode byte
 
 const (
-	OpConstant Opcode = iota // 加载常量
-	OpAdd                    // 加
-	OpSub                    // 减
+	OpConstant      Opcode = iota // 加载常量
+	OpAdd                         // 加
+	OpSub                         // 减
+	OpPow                         // 乘方
+	OpMul                         // 乘
+	OpDiv                         // 除
+	OpMod                         // 取模
+	OpEqual                       // 等于
+	OpNotEqual                    // 不等于
+	OpGreaterThan                 // 大于（小于通过交换操作数实现）
+	OpGreaterEqual                // 大于等于（小于等于通过交换操作数实现）
+	OpTrue                        // 压入 true
+	OpFalse                       // 压入 false
+	OpBang                        // 逻辑非
+	OpMinus                       // 取负
+	OpPop                         // 弹出栈顶（表达式语句结束）
+	OpSetGlobal                   // 弹出栈顶并存入全局变量
+	OpGetGlobal                   // 读取全局变量并压栈
+	OpJump                        // 无条件跳转到操作数给出的偏移
+	OpJumpNotTruthy               // 弹出栈顶，为假时跳转到操作数给出的偏移
+	OpPrint                       // 弹出格式字符串和参数（共操作数个）并格式化输出
 )
 
-// 用于调试
+// Definition 描述一个操作码：助记符以及每个操作数的字节宽度
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+// 操作码定义表，编码、解码、反汇编、汇编和字节码校验都以此为准
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}}, // 常量池索引
+	OpAdd:      {"OpAdd", []int{}},
+	OpSub:      {"OpSub", []int{}},
+	OpPow:      {"OpPow", []int{}},
+	OpMul:      {"OpMul", []int{}},
+	OpDiv:      {"OpDiv", []int{}},
+	OpMod:      {"OpMod", []int{}},
+
+	OpEqual:        {"OpEqual", []int{}},
+	OpNotEqual:     {"OpNotEqual", []int{}},
+	OpGreaterThan:  {"OpGreaterThan", []int{}},
+	OpGreaterEqual: {"OpGreaterEqual", []int{}},
+	OpTrue:         {"OpTrue", []int{}},
+	OpFalse:        {"OpFalse", []int{}},
+	OpBang:         {"OpBang", []int{}},
+	OpMinus:        {"OpMinus", []int{}},
+	OpPop:          {"OpPop", []int{}},
+	OpSetGlobal:    {"OpSetGlobal", []int{2}}, // 全局变量槽位
+	OpGetGlobal:    {"OpGetGlobal", []int{2}}, // 全局变量槽位
+
+	OpJump:          {"OpJump", []int{2}},          // 跳转目标偏移
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}}, // 跳转目标偏移
+	OpPrint:         {"OpPrint", []int{1}},         // 参数个数（含格式字符串）
+}
+
+// Lookup 返回操作码的定义，未定义的操作码返回错误
+func Lookup(op Opcode) (*Definition, error) {
+	def, ok := definitions[op]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", byte(op))
+	}
+	return def, nil
+}
+
+// OperandWidths 返回操作码每个操作数的字节宽度
+// 第二个返回值为 false 表示该操作码未定义
+func OperandWidths(op Opcode) ([]int, bool) {
+	def, ok := definitions[op]
+	if !ok {
+		return nil, false
+	}
+	return def.OperandWidths, true
+}
+
+// String 返回操作码的助记符
+func (op Opcode) String() string {
+	if def, ok := definitions[op]; ok {
+		return def.Name
+	}
+	return fmt.Sprintf("Opcode(%d)", byte(op))
+}
+
+// String 将指令反汇编为文本，每行一条指令并以偏移开头，如 "0000 OpConstant 0"
+// 操作数按定义表中的宽度解码，因此新增的操作码无需修改此处；
+// 遇到未定义的操作码或被截断的操作数时输出 ERROR 行而不是静默跳过
 func (ins Instructions) String() string {
 	var out string
 	i := 0
 	for i < len(ins) {
 		op := Opcode(ins[i])
-		switch op {
-		case OpConstant:
-			// OpConstant 指令后面跟着一个2字节的操作数 (常量池索引)
-			operand := int(ins[i+1])<<8 | int(ins[i+2])
-			out += fmt.Sprintf("OpConstant %d\n", operand)
-			i += 3
-		case OpAdd:
-			out += "OpAdd\n"
-			i++
-		case OpSub:
-			out += "OpSub\n"
+		def, ok := definitions[op]
+		if !ok {
+			out += fmt.Sprintf("%04d ERROR: unknown opcode %d\n", i, ins[i])
 			i++
+			continue
+		}
+
+		operands, read, ok := ReadOperands(def, ins[i+1:])
+		if !ok {
+			return out + fmt.Sprintf("%04d ERROR: truncated operand for %s\n", i, op)
+		}
+
+		line := def.Name
+		for _, operand := range operands {
+			line += fmt.Sprintf(" %d", operand)
 		}
+		out += fmt.Sprintf("%04d %s\n", i, line)
+		i += 1 + read
 	}
 	return out
 }
 
+// Make 按操作码定义的宽度将操作码和操作数编码为字节序列（多字节操作数为大端序）
+// 操作码未定义时返回空切片
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	ins := []byte{byte(op)}
+	for i, o := range operands {
+		switch def.OperandWidths[i] {
+		case 2:
+			ins = append(ins, byte(o>>8), byte(o)) // 高位在前
+		case 1:
+			ins = append(ins, byte(o))
+		}
+	}
+	return ins
+}
+
+// ReadOperands 按定义解码紧跟在操作码之后的操作数
+// ins 从第一个操作数开始；返回操作数、读取的字节数，
+// 操作数超出 ins 末尾时第三个返回值为 false
+func ReadOperands(def *Definition, ins Instructions) ([]int, int, bool) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+	for i, w := range def.OperandWidths {
+		if offset+w > len(ins) {
+			return nil, 0, false
+		}
+		switch w {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+		offset += w
+	}
+	return operands, offset, true
+}
+
+// ReadUint16 读取 ins 开头的2字节大端序操作数
+// VM 执行时已知操作数宽度，直接调用它以避免 ReadOperands 分配切片
+func ReadUint16(ins Instructions) uint16 {
+	return uint16(ins[0])<<8 | uint16(ins[1])
+}
+
+// ReadUint8 读取 ins 开头的1字节操作数
+func ReadUint8(ins Instructions) uint8 {
+	return ins[0]
+}
+
+// Position 表示源代码中的位置
+type Position struct {
+	Line   int
+	Column int
+}
+
 type Bytecode struct {
 	Instructions Instructions
 	Constants    []interface{}
+	// Positions 与 Instructions 逐字节对应，记录每条指令来自的源码位置
+	// 手工构造或汇编得到的字节码可以没有位置信息
+	Positions []Position
+}
+
+// PositionAt 返回指令偏移处对应的源码位置，没有位置信息时返回 false
+func (b *Bytecode) PositionAt(offset int) (Position, bool) {
+	if offset < 0 || offset >= len(b.Positions) {
+		return Position{}, false
+	}
+	return b.Positions[offset], true
+}
+
+// SourceMapEntry 将一条指令的起始偏移对应到源码的行和列
+type SourceMapEntry struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// SourceMap 按偏移顺序为每条指令导出一个源码映射条目，
+// 供序列化后在别处执行的字节码定位回源码；没有位置信息的指令不导出条目
+func (b *Bytecode) SourceMap() []SourceMapEntry {
+	entries := []SourceMapEntry{}
+	ip := 0
+	for ip < len(b.Instructions) {
+		if pos, ok := b.PositionAt(ip); ok {
+			entries = append(entries, SourceMapEntry{Offset: ip, Line: pos.Line, Column: pos.Column})
+		}
+
+		def, ok := definitions[Opcode(b.Instructions[ip])]
+		if !ok {
+			break // 无法确定后续指令的边界
+		}
+		_, read, ok := ReadOperands(def, b.Instructions[ip+1:])
+		if !ok {
+			break
+		}
+		ip += 1 + read
+	}
+	return entries
 }
@@ -2,29 +2,325 @@ package compiler
 
 import (
 	"Butterfly/ast"
+	"Butterfly/lexer"
+	"fmt"
+	"math"
 )
 
 type Compiler struct {
 	instructions Instructions
 	constants    []interface{}
+	positions    []Position // 与 instructions 逐字节对应的源码位置
+
+	pos Position // 当前正在编译的节点的源码位置
+
+	symbolTable *SymbolTable
+
+	loops []*loop // 正在编译的循环，最内层在末尾
+
+	warnings []Warning // 不影响编译结果的诊断信息
+
+	// 声明时没有初始值、且在某条执行路径上可能尚未赋值的变量，按全局槽位索引记录
+	unassigned map[int]bool
+
+	errPos    Position // Compile 返回的错误所在的源码位置
+	hasErrPos bool
+
+	// 发出指令时遇到的第一个错误（如操作数超出宽度），由 Compile 返回
+	emitErr error
+
+	strictConditions bool // 严格模式下 if/while/for 的条件必须是布尔表达式
+	int32Mode        bool // 32位模式下整数字面量必须在 int32 范围内
+}
+
+// Warning 是一条带源码位置的编译警告
+type Warning struct {
+	Pos     Position
+	Message string
+}
+
+// loop 记录一个循环中等待回填的 break 和 continue 跳转
+type loop struct {
+	breaks    []int // break 生成的 OpJump 偏移，回填为循环结束处
+	continues []int // continue 生成的 OpJump 偏移，回填为下一次迭代的起点
 }
 
 func New() *Compiler {
 	return &Compiler{
 		instructions: Instructions{},
 		constants:    []interface{}{},
+		positions:    []Position{},
+		symbolTable:  NewSymbolTable(),
+		unassigned:   map[int]bool{},
 	}
 }
 
-func (c *Compiler) Compile(node ast.Node) error {
+// NewWithState 创建一个沿用已有符号表和常量池的编译器，
+// 交互模式逐行编译时借此让前面各行声明的变量继续可用
+func NewWithState(s *SymbolTable, constants []interface{}) *Compiler {
+	c := New()
+	c.symbolTable = s
+	c.constants = constants
+	return c
+}
+
+func (c *Compiler) Compile(node ast.Node) (err error) {
+	// emit 和 changeOperand 不返回错误，编译结束时检查它们记录的错误
+	defer func() {
+		if err == nil {
+			err = c.emitErr
+		}
+	}()
+
+	// 发出的指令记录当前节点的位置；子节点编译完成后恢复，使本节点的指令对应自身位置
+	// 编译出错时，出错的最内层节点最先返回，记录它的位置作为错误位置
+	if pos, ok := positionOf(node); ok {
+		saved := c.pos
+		c.pos = pos
+		defer func() {
+			if err != nil && !c.hasErrPos {
+				c.errPos, c.hasErrPos = pos, true
+			}
+			c.pos = saved
+		}()
+	}
+
 	switch node := node.(type) {
 	case *ast.Program:
+		for _, s := range node.Statements {
+			err := c.Compile(s)
+			if err != nil {
+				return err
+			}
+		}
+
+	case *ast.ExpressionStatement:
 		err := c.Compile(node.Expression)
 		if err != nil {
 			return err
 		}
+		// 表达式语句的值不再使用，弹出以保持栈平衡
+		c.emit(OpPop)
+
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			err := c.Compile(s)
+			if err != nil {
+				return err
+			}
+		}
+
+	case *ast.IfStatement:
+		err := c.compileCondition(node.Condition)
+		if err != nil {
+			return err
+		}
+
+		// 跳转目标在分支编译完成后才能确定，先写入占位操作数再回填
+		jumpNotTruthyPos := c.emit(OpJumpNotTruthy, 9999)
+
+		// 只有两个分支都赋值的变量，在条件语句之后才算已赋值
+		beforeBranches := c.saveUnassigned()
+		err = c.Compile(node.Consequence)
+		if err != nil {
+			return err
+		}
+
+		if node.Alternative == nil {
+			c.mergeUnassigned(beforeBranches)
+			c.changeOperand(jumpNotTruthyPos, len(c.instructions))
+			return nil
+		}
+		afterConsequence := c.unassigned
+		c.unassigned = beforeBranches
+
+		// 执行完 then 分支后跳过 else 分支
+		jumpPos := c.emit(OpJump, 9999)
+		c.changeOperand(jumpNotTruthyPos, len(c.instructions))
+
+		err = c.Compile(node.Alternative)
+		if err != nil {
+			return err
+		}
+		c.mergeUnassigned(afterConsequence)
+		c.changeOperand(jumpPos, len(c.instructions))
+
+	case *ast.WhileStatement:
+		// 每次循环都回到条件处重新求值，条件为假时跳出循环
+		loopStart := len(c.instructions)
+
+		err := c.compileCondition(node.Condition)
+		if err != nil {
+			return err
+		}
+		exitPos := c.emit(OpJumpNotTruthy, 9999)
+
+		// 循环体可能一次也不执行，其中的赋值在循环之后不算数
+		beforeBody := c.saveUnassigned()
+		c.enterLoop()
+		err = c.Compile(node.Body)
+		if err != nil {
+			return err
+		}
+		c.mergeUnassigned(beforeBody)
+		c.emit(OpJump, loopStart)
+		c.changeOperand(exitPos, len(c.instructions))
+
+		// while 循环的 continue 回到条件处重新求值
+		c.leaveLoop(loopStart, len(c.instructions))
+
+	case *ast.ForStatement:
+		// 初始化子句声明的变量只在循环内可见，连续的循环可以各自声明同名的循环变量
+		c.symbolTable.EnterScope()
+		defer c.symbolTable.LeaveScope()
+
+		if node.Init != nil {
+			err := c.Compile(node.Init)
+			if err != nil {
+				return err
+			}
+		}
+
+		loopStart := len(c.instructions)
+
+		// 省略条件时不生成条件跳转，循环只能通过其他方式结束
+		exitPos := -1
+		if node.Condition != nil {
+			err := c.compileCondition(node.Condition)
+			if err != nil {
+				return err
+			}
+			exitPos = c.emit(OpJumpNotTruthy, 9999)
+		}
+
+		beforeBody := c.saveUnassigned()
+		c.enterLoop()
+		err := c.Compile(node.Body)
+		if err != nil {
+			return err
+		}
+
+		// for 循环的 continue 先执行更新子句，保证循环变量照常递增
+		postStart := len(c.instructions)
+		if node.Post != nil {
+			err := c.Compile(node.Post)
+			if err != nil {
+				return err
+			}
+			c.emit(OpPop)
+		}
+		c.mergeUnassigned(beforeBody)
+		c.emit(OpJump, loopStart)
+
+		if exitPos >= 0 {
+			c.changeOperand(exitPos, len(c.instructions))
+		}
+		c.leaveLoop(postStart, len(c.instructions))
+
+	case *ast.PrintfStatement:
+		// OpPrint 的操作数只有1字节
+		if len(node.Arguments)+1 > 0xFF {
+			return fmt.Errorf("too many arguments to printf: %d", len(node.Arguments))
+		}
+		// 格式字符串和参数依次压栈，由 OpPrint 一并弹出
+		err := c.Compile(node.Format)
+		if err != nil {
+			return err
+		}
+		for _, arg := range node.Arguments {
+			err := c.Compile(arg)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(OpPrint, len(node.Arguments)+1)
+
+	case *ast.BreakStatement:
+		if len(c.loops) == 0 {
+			return fmt.Errorf("break outside loop")
+		}
+		current := c.loops[len(c.loops)-1]
+		current.breaks = append(current.breaks, c.emit(OpJump, 9999))
+
+	case *ast.ContinueStatement:
+		if len(c.loops) == 0 {
+			return fmt.Errorf("continue outside loop")
+		}
+		current := c.loops[len(c.loops)-1]
+		current.continues = append(current.continues, c.emit(OpJump, 9999))
+
+	case *ast.LetStatement:
+		if c.symbolTable.DefinedInScope(node.Name.Value) {
+			return fmt.Errorf("variable %s already declared", node.Name.Value)
+		}
+		// char 只能保存单字节的值，初始值为明显越界的整数字面量时给出警告
+		if lit, ok := node.Value.(*ast.IntegerLiteral); ok && node.Token.Type == lexer.CHAR && (lit.Value < 0 || lit.Value > 0xFF) {
+			c.warn("integer %d out of range for char", lit.Value)
+		}
+		// 没有初始值的变量初始化为 0
+		if node.Value == nil {
+			c.emit(OpConstant, c.addConstant(int64(0)))
+		} else {
+			err := c.Compile(node.Value)
+			if err != nil {
+				return err
+			}
+		}
+		// 初始值编译完成后再定义符号，使 int x = x; 中的 x 不能引用自身
+		symbol := c.symbolTable.Define(node.Name.Value)
+		c.emit(OpSetGlobal, symbol.Index)
+		if node.Value == nil {
+			c.unassigned[symbol.Index] = true
+		}
+
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			return fmt.Errorf("undefined variable %s", node.Value)
+		}
+		// 每个变量只警告一次，之后的读取不再重复报告
+		if c.unassigned[symbol.Index] {
+			c.warn("variable %s is used before being assigned", node.Value)
+			delete(c.unassigned, symbol.Index)
+		}
+		c.emit(OpGetGlobal, symbol.Index)
+
+	case *ast.AssignExpression:
+		symbol, ok := c.symbolTable.Resolve(node.Name.Value)
+		if !ok {
+			return fmt.Errorf("undefined variable %s", node.Name.Value)
+		}
+		if value, ok := node.Value.(*ast.Identifier); ok && value.Value == node.Name.Value {
+			c.warn("self-assignment has no effect")
+		}
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+		// 赋值表达式本身的值是赋给变量的值，存入后重新读取压栈
+		delete(c.unassigned, symbol.Index)
+		c.emit(OpSetGlobal, symbol.Index)
+		c.emit(OpGetGlobal, symbol.Index)
 
 	case *ast.InfixExpression:
+		// < 和 <= 通过交换操作数转换为 > 和 >=
+		if node.Operator == "<" || node.Operator == "<=" {
+			err := c.Compile(node.Right)
+			if err != nil {
+				return err
+			}
+			err = c.Compile(node.Left)
+			if err != nil {
+				return err
+			}
+			if node.Operator == "<" {
+				c.emit(OpGreaterThan)
+			} else {
+				c.emit(OpGreaterEqual)
+			}
+			return nil
+		}
+
 		err := c.Compile(node.Left)
 		if err != nil {
 			return err
@@ -39,31 +335,277 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(OpAdd)
 		case "-":
 			c.emit(OpSub)
+		case "*":
+			c.emit(OpMul)
+		case "/":
+			c.emit(OpDiv)
+		case "%":
+			c.emit(OpMod)
+		case ">":
+			c.emit(OpGreaterThan)
+		case ">=":
+			c.emit(OpGreaterEqual)
+		case "==":
+			c.emit(OpEqual)
+		case "!=":
+			c.emit(OpNotEqual)
+		case "**":
+			c.emit(OpPow)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+
+	case *ast.PrefixExpression:
+		err := c.Compile(node.Right)
+		if err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "!":
+			c.emit(OpBang)
+		case "-":
+			c.emit(OpMinus)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+
+	case *ast.CastExpression:
+		// 转换为 char 时沿用声明 char 变量的越界检查
+		if lit, ok := node.Right.(*ast.IntegerLiteral); ok && node.Type.Type == lexer.CHAR && (lit.Value < 0 || lit.Value > 0xFF) {
+			c.warn("integer %d out of range for char", lit.Value)
+		}
+		// int 和 char 都以 int64 存储，转换不生成额外的指令
+		err := c.Compile(node.Right)
+		if err != nil {
+			return err
+		}
+
+	case *ast.BooleanLiteral:
+		if node.Value {
+			c.emit(OpTrue)
+		} else {
+			c.emit(OpFalse)
 		}
 
 	case *ast.IntegerLiteral:
-		c.constants = append(c.constants, node.Value)
+		// 与 C 语言相同，-2147483648 是对 2147483648 取负，因此也超出范围
+		if c.int32Mode && (node.Value < math.MinInt32 || node.Value > math.MaxInt32) {
+			return fmt.Errorf("integer literal %d out of range for 32-bit int", node.Value)
+		}
 		// 将常量的索引作为 OpConstant 的操作数
-		c.emit(OpConstant, len(c.constants)-1)
+		c.emit(OpConstant, c.addConstant(node.Value))
+
+	case *ast.FloatLiteral:
+		c.emit(OpConstant, c.addConstant(node.Value))
+
+	case *ast.StringLiteral:
+		c.emit(OpConstant, c.addConstant(node.Value))
+
+	case *ast.CharLiteral:
+		// 字符按码点以整数形式存储，可直接参与算术和比较
+		c.emit(OpConstant, c.addConstant(int64(node.Value)))
 	}
 
 	return nil
 }
 
-// emit 发出指令和操作数
-func (c *Compiler) emit(op Opcode, operands ...int) {
-	ins := []byte{byte(op)}
-	for _, o := range operands {
-		// 这里我们假设操作数是2字节的
-		ins = append(ins, byte(o>>8)) // 高位
-		ins = append(ins, byte(o))    // 低位
+// addConstant 将常量加入常量池并返回其索引
+// 若池中已有相等的常量（类型和值都相同），则直接复用已有索引
+func (c *Compiler) addConstant(obj interface{}) int {
+	for i, existing := range c.constants {
+		if existing == obj {
+			return i
+		}
 	}
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+// emit 发出指令和操作数，并记录其对应的源码位置
+// 返回该指令的起始偏移，供之后回填操作数使用
+// 操作数超出其宽度时记录错误，由 Compile 返回
+func (c *Compiler) emit(op Opcode, operands ...int) int {
+	c.checkOperands(op, operands...)
+	pos := len(c.instructions)
+	ins := Make(op, operands...)
 	c.instructions = append(c.instructions, ins...)
+	for range ins {
+		c.positions = append(c.positions, c.pos)
+	}
+	return pos
+}
+
+// EnableStrictConditions 开启严格条件模式：if、while、for 的条件必须是布尔表达式，
+// 不再允许像 C 语言那样把整数隐式当作真假值使用
+func (c *Compiler) EnableStrictConditions() {
+	c.strictConditions = true
+}
+
+// EnableInt32Mode 开启32位整数模式，超出 int32 范围的整数字面量成为编译错误
+// 运行时的32位回绕由虚拟机的同名选项负责
+func (c *Compiler) EnableInt32Mode() {
+	c.int32Mode = true
+}
+
+// compileCondition 编译循环或分支的条件，严格模式下先检查条件是否为布尔表达式
+func (c *Compiler) compileCondition(cond ast.Expression) error {
+	if c.strictConditions && !isBooleanExpression(cond) {
+		return fmt.Errorf("condition %s is not boolean; compare explicitly, e.g. %s != 0", cond, cond)
+	}
+	return c.Compile(cond)
+}
+
+// isBooleanExpression 判断表达式的结果是否一定是布尔值
+// 变量只能声明为 int 或 char，因此只有比较、逻辑非和布尔字面量是布尔表达式
+func isBooleanExpression(node ast.Expression) bool {
+	switch node := node.(type) {
+	case *ast.BooleanLiteral:
+		return true
+	case *ast.PrefixExpression:
+		return node.Operator == "!"
+	case *ast.InfixExpression:
+		switch node.Operator {
+		case "==", "!=", "<", "<=", ">", ">=":
+			return true
+		}
+	}
+	return false
+}
+
+// saveUnassigned 复制当前可能未赋值的变量集合，供分支或循环体编译完成后合并
+func (c *Compiler) saveUnassigned() map[int]bool {
+	saved := make(map[int]bool, len(c.unassigned))
+	for index := range c.unassigned {
+		saved[index] = true
+	}
+	return saved
+}
+
+// mergeUnassigned 合并另一条执行路径上可能未赋值的变量：
+// 任一路径上未赋值的变量，在路径汇合之后仍可能未赋值
+func (c *Compiler) mergeUnassigned(other map[int]bool) {
+	for index := range other {
+		c.unassigned[index] = true
+	}
+}
+
+// warn 在当前节点的位置记录一条警告，编译继续进行
+func (c *Compiler) warn(format string, args ...interface{}) {
+	c.warnings = append(c.warnings, Warning{Pos: c.pos, Message: fmt.Sprintf(format, args...)})
+}
+
+// Warnings 返回编译过程中产生的警告信息，按产生顺序排列
+func (c *Compiler) Warnings() []string {
+	messages := make([]string, len(c.warnings))
+	for i, w := range c.warnings {
+		messages[i] = w.Message
+	}
+	return messages
+}
+
+// WarningDetails 返回带源码位置的警告，顺序与 Warnings() 一致
+func (c *Compiler) WarningDetails() []Warning {
+	return c.warnings
+}
+
+// ErrorPosition 返回 Compile 所返回错误的源码位置，即出错的最内层节点的位置
+// 没有编译错误或错误与具体节点无关时第二个返回值为 false
+func (c *Compiler) ErrorPosition() (Position, bool) {
+	return c.errPos, c.hasErrPos
+}
+
+// enterLoop 开始编译一个循环体，此后的 break 和 continue 属于该循环
+func (c *Compiler) enterLoop() {
+	c.loops = append(c.loops, &loop{})
+}
+
+// leaveLoop 结束最内层循环，将其中的 continue 回填为 continueTarget，break 回填为 breakTarget
+func (c *Compiler) leaveLoop(continueTarget, breakTarget int) {
+	current := c.loops[len(c.loops)-1]
+	c.loops = c.loops[:len(c.loops)-1]
+
+	for _, pos := range current.continues {
+		c.changeOperand(pos, continueTarget)
+	}
+	for _, pos := range current.breaks {
+		c.changeOperand(pos, breakTarget)
+	}
+}
+
+// changeOperand 替换 pos 处已发出指令的操作数，用于回填跳转目标
+func (c *Compiler) changeOperand(pos int, operand int) {
+	op := Opcode(c.instructions[pos])
+	c.checkOperands(op, operand)
+	copy(c.instructions[pos:], Make(op, operand))
+}
+
+// checkOperands 检查操作数能否用操作码定义的宽度表示，否则记录错误
+// 例如程序过大时跳转目标或常量索引超过2字节，编码时会被截断
+func (c *Compiler) checkOperands(op Opcode, operands ...int) {
+	widths, _ := OperandWidths(op)
+	for i, operand := range operands {
+		if c.emitErr == nil && (operand < 0 || operand >= 1<<(8*widths[i])) {
+			c.emitErr = fmt.Errorf("operand %d does not fit in %d-byte operand of %s", operand, widths[i], op)
+		}
+	}
+}
+
+// positionOf 返回节点对应的源码位置，运算符节点取运算符所在位置
+func positionOf(node ast.Node) (Position, bool) {
+	var tok lexer.Token
+	switch node := node.(type) {
+	case *ast.ExpressionStatement:
+		tok = node.Token
+	case *ast.IfStatement:
+		tok = node.Token
+	case *ast.WhileStatement:
+		tok = node.Token
+	case *ast.ForStatement:
+		tok = node.Token
+	case *ast.PrintfStatement:
+		tok = node.Token
+	case *ast.BreakStatement:
+		tok = node.Token
+	case *ast.ContinueStatement:
+		tok = node.Token
+	case *ast.LetStatement:
+		tok = node.Token
+	case *ast.Identifier:
+		tok = node.Token
+	case *ast.AssignExpression:
+		tok = node.Token
+	case *ast.InfixExpression:
+		tok = node.Token
+	case *ast.PrefixExpression:
+		tok = node.Token
+	case *ast.CastExpression:
+		tok = node.Token
+	case *ast.IntegerLiteral:
+		tok = node.Token
+	case *ast.FloatLiteral:
+		tok = node.Token
+	case *ast.CharLiteral:
+		tok = node.Token
+	case *ast.StringLiteral:
+		tok = node.Token
+	case *ast.BooleanLiteral:
+		tok = node.Token
+	default:
+		return Position{}, false
+	}
+	return Position{Line: tok.Line, Column: tok.Column}, true
+}
+
+// SymbolTable 返回编译过程中建立的符号表，用于调试变量解析
+func (c *Compiler) SymbolTable() *SymbolTable {
+	return c.symbolTable
 }
 
 func (c *Compiler) Bytecode() *Bytecode {
 	return &Bytecode{
 		Instructions: c.instructions,
 		Constants:    c.constants,
+		Positions:    c.positions,
 	}
 }
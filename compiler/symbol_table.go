@@ -0,0 +1,91 @@
+package compiler
+
+// SymbolScope 表示符号所在的作用域
+type SymbolScope string
+
+const (
+	GlobalScope SymbolScope = "GLOBAL"
+)
+
+// Symbol 记录一个已声明变量的名称、作用域和存储槽位
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+// SymbolTable 将变量名映射到全局变量槽位的索引
+// 块作用域（如 for 循环的初始化子句）中声明的变量同样占用全局槽位，
+// 只是在离开作用域后不再能按名称找到，并恢复被它遮蔽的外层变量
+type SymbolTable struct {
+	store   map[string]Symbol
+	symbols []Symbol // 所有定义过的符号，按槽位索引排列
+
+	// 每层块作用域中声明的名称及其遮蔽的外层符号，不存在外层符号时 ok 为 false
+	scopes []map[string]shadowed
+}
+
+// shadowed 记录被块作用域中同名变量遮蔽的外层符号
+type shadowed struct {
+	symbol Symbol
+	ok     bool
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{store: map[string]Symbol{}}
+}
+
+// Define 为变量分配下一个全局槽位并返回对应的符号
+func (s *SymbolTable) Define(name string) Symbol {
+	symbol := Symbol{Name: name, Scope: GlobalScope, Index: len(s.symbols)}
+	if len(s.scopes) > 0 {
+		scope := s.scopes[len(s.scopes)-1]
+		if _, ok := scope[name]; !ok {
+			outer, ok := s.store[name]
+			scope[name] = shadowed{symbol: outer, ok: ok}
+		}
+	}
+	s.store[name] = symbol
+	s.symbols = append(s.symbols, symbol)
+	return symbol
+}
+
+// Symbols 按定义顺序（即槽位索引顺序）返回所有符号，包括已离开作用域的符号
+func (s *SymbolTable) Symbols() []Symbol {
+	return append([]Symbol(nil), s.symbols...)
+}
+
+// Resolve 按名称查找符号，未声明时第二个返回值为 false
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	return symbol, ok
+}
+
+// DefinedInScope 判断名称是否已在当前作用域中声明，外层作用域的同名变量可以被遮蔽
+func (s *SymbolTable) DefinedInScope(name string) bool {
+	if len(s.scopes) == 0 {
+		_, ok := s.store[name]
+		return ok
+	}
+	_, ok := s.scopes[len(s.scopes)-1][name]
+	return ok
+}
+
+// EnterScope 开始一个块作用域，此后声明的变量在 LeaveScope 之后不再可见
+func (s *SymbolTable) EnterScope() {
+	s.scopes = append(s.scopes, map[string]shadowed{})
+}
+
+// LeaveScope 结束最内层块作用域，移除其中声明的名称并恢复被遮蔽的外层符号
+func (s *SymbolTable) LeaveScope() {
+	scope := s.scopes[len(s.scopes)-1]
+	s.scopes = s.scopes[:len(s.scopes)-1]
+
+	for name, outer := range scope {
+		if outer.ok {
+			s.store[name] = outer.symbol
+		} else {
+			delete(s.store, name)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package lexer
+
+import "fmt" // 导入 fmt 包，用于格式化错误信息。
+
+// Error 表示一个词法错误，记录出错的位置和错误信息。
+// NextToken 遇到词法错误时以 *Error 作为 panic 的值；
+// 开启错误恢复后则改为记录错误并继续分析。
+type Error struct {
+	Line    int    // 出错位置的行号。
+	Column  int    // 出错位置的列号。
+	Message string // 完整的错误信息。
+}
+
+// Error 返回错误信息，使 *Error 满足 error 接口。
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// newError 创建一个位于指定位置的词法错误。
+func newError(line, column int, format string, args ...interface{}) *Error {
+	return &Error{Line: line, Column: column, Message: fmt.Sprintf(format, args...)}
+}
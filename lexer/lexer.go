@@ -3,7 +3,6 @@
 package lexer
 
 import (
-	"fmt"     // 导入 fmt 包，用于格式化字符串，主要在错误处理中使用。
 	"unicode" // 导入 unicode 包，提供了一系列函数来检查字符的属性（如是否是字母、数字、空白等）。
 )
 
@@ -15,6 +14,9 @@ type Lexer struct {
 	line        int    // 当前所在的代码行号，用于错误定位。
 	column      int    // 当前所在的代码列号，用于错误定位。
 	currentChar rune   // 当前正在检查的字符。使用 rune 类型以支持 Unicode 字符。
+
+	recovery bool     // 是否开启错误恢复，开启后词法错误不再引发恐慌。
+	errors   []*Error // 错误恢复模式下记录的词法错误，按出现顺序排列。
 }
 
 // reverseKeywords 是一个从字符串到 TokenType 的反向映射表。
@@ -41,6 +43,8 @@ var reverseKeywords = map[string]TokenType{
 	"return":   RETURN,
 	"break":    BREAK,
 	"continue": CONTINUE,
+	"true":     TRUE,
+	"false":    FALSE,
 }
 
 // New 是 Lexer 的构造函数，用于创建一个新的词法分析器实例。
@@ -77,6 +81,15 @@ func (l *Lexer) advance() {
 	l.column++ // 不论如何，列号都加 1。
 }
 
+// peekChar 方法返回当前字符之后的下一个字符，但不移动位置。
+// 如果已到达输入末尾，则返回 0。
+func (l *Lexer) peekChar() rune {
+	if l.pos+1 >= len(l.input) {
+		return 0
+	}
+	return rune(l.input[l.pos+1])
+}
+
 // skipWhitespace 方法会跳过所有连续的空白字符（如空格、制表符、换行符等）。
 func (l *Lexer) skipWhitespace() {
 	// 循环直到当前字符不再是空白字符。
@@ -85,6 +98,33 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
+// skipLineComment 方法跳过以 "//" 开始的单行注释，直到行尾（不包括换行符）。
+func (l *Lexer) skipLineComment() {
+	for l.currentChar != '\n' && l.currentChar != 0 {
+		l.advance()
+	}
+}
+
+// skipBlockComment 方法跳过以 "/*" 开始、以 "*/" 结束的块注释。
+// 注释内部的换行由 advance 负责更新行号和列号。
+func (l *Lexer) skipBlockComment() {
+	startLine := l.line  // 记录起始行号。
+	startCol := l.column // 记录起始列号。
+	l.advance()          // 跳过 '/'。
+	l.advance()          // 跳过 '*'。
+
+	// 循环直到遇到 "*/" 或文件末尾。
+	for !(l.currentChar == '*' && l.peekChar() == '/') {
+		if l.currentChar == 0 {
+			// 到达文件末尾仍未闭合，引发恐慌而不是无限循环。
+			panic(newError(startLine, startCol, "块注释未闭合，起始于行 %d:%d", startLine, startCol))
+		}
+		l.advance()
+	}
+	l.advance() // 跳过 '*'。
+	l.advance() // 跳过 '/'。
+}
+
 // readIdentifier 方法读取一个完整的标识符或关键字。
 // 标识符通常由字母和数字组成，且以字母开头。
 func (l *Lexer) readIdentifier() Token {
@@ -109,23 +149,92 @@ func (l *Lexer) readIdentifier() Token {
 	return Token{tokenType, value, startLine, startCol}
 }
 
+// isHexDigit 判断字符是否是十六进制数字（0-9, a-f, A-F）。
+func isHexDigit(ch rune) bool {
+	return unicode.IsDigit(ch) || (ch >= 'a' && ch <= 'f') || (ch >= 'A' && ch <= 'F')
+}
+
+// isBinaryDigit 判断字符是否是二进制数字（0 或 1）。
+func isBinaryDigit(ch rune) bool {
+	return ch == '0' || ch == '1'
+}
+
 // readNumber 方法读取一个完整的整型数字字面量。
+// 除十进制外，还支持 0x/0X 开头的十六进制和 0b/0B 开头的二进制，
+// 前缀会保留在 Token 的值中，由语法分析器按进制解析（以 0 开头的八进制同理）。
 func (l *Lexer) readNumber() Token {
 	startPos := l.pos    // 记录数字的起始位置。
 	startLine := l.line  // 记录起始行号。
 	startCol := l.column // 记录起始列号。
 
+	// 根据前缀选择数字字符的判断规则，默认为十进制。
+	isDigit := unicode.IsDigit
+	prefixed := false
+	if l.currentChar == '0' {
+		switch l.peekChar() {
+		case 'x', 'X':
+			isDigit, prefixed = isHexDigit, true
+		case 'b', 'B':
+			isDigit, prefixed = isBinaryDigit, true
+		}
+	}
+	// 跳过 "0x"/"0b" 前缀，并要求前缀后至少有一位数字。
+	if prefixed {
+		l.advance()
+		l.advance()
+		if !isDigit(l.currentChar) {
+			panic(newError(startLine, startCol, "无效数字: %s 在行 %d:%d", l.input[startPos:l.pos], startLine, startCol))
+		}
+	}
+
 	// 持续前进，直到当前字符不再是数字。
-	for unicode.IsDigit(l.currentChar) {
+	for isDigit(l.currentChar) {
 		l.advance()
 	}
 
+	// 十进制数字后跟小数点和数字时，解析为浮点数。
+	if !prefixed && l.currentChar == '.' && unicode.IsDigit(l.peekChar()) {
+		l.advance() // 跳过小数点。
+		for unicode.IsDigit(l.currentChar) {
+			l.advance()
+		}
+		// 浮点数只能包含一个小数点，例如 1.2.3 是无效的。
+		if l.currentChar == '.' {
+			panic(newError(startLine, startCol, "无效数字: %s. 在行 %d:%d", l.input[startPos:l.pos], startLine, startCol))
+		}
+		// 返回 FLOAT 类型的 Token。
+		return Token{FLOAT, l.input[startPos:l.pos], startLine, startCol}
+	}
+
 	// 提取数字字符串。
 	value := l.input[startPos:l.pos]
 	// 返回 NUMBER 类型的 Token。
 	return Token{NUMBER, value, startLine, startCol}
 }
 
+// isOctalDigit 判断字符是否是八进制数字（0-7）。
+func isOctalDigit(ch rune) bool {
+	return ch >= '0' && ch <= '7'
+}
+
+// readOctalEscape 方法读取反斜杠之后的 1 到 3 位八进制数字（例如 \0, \101），
+// 返回对应的字节值。调用时 currentChar 应为第一位八进制数字。
+func (l *Lexer) readOctalEscape() byte {
+	startLine := l.line  // 记录起始行号。
+	startCol := l.column // 记录起始列号。
+	value := 0
+	// 最多读取 3 位八进制数字。
+	for i := 0; i < 3 && isOctalDigit(l.currentChar); i++ {
+		value = value*8 + int(l.currentChar-'0')
+		l.advance()
+	}
+	// 超出单字节范围的八进制转义是无效的。
+	if value > 0xFF {
+		panic(newError(startLine, startCol, "八进制转义超出范围: \\%o 在行 %d:%d", value, startLine, startCol))
+	}
+	return byte(value)
+}
+
 // readChar 方法解析一个字符字面量（例如 'a', '\n'）。
 func (l *Lexer) readChar() Token {
 	startLine := l.line  // 记录起始行号。
@@ -136,22 +245,27 @@ func (l *Lexer) readChar() Token {
 	// 检查是否是转义字符。
 	if l.currentChar == '\\' {
 		l.advance() // 跳过反斜杠。
-		switch l.currentChar {
-		case 'n':
-			value = "\n"
-		case 't':
-			value = "\t"
-		case 'r':
-			value = "\r"
-		case '\'':
-			value = "'"
-		case '\\':
-			value = "\\"
-		default:
-			// 如果是未知的转义序列，则引发恐慌（panic）。
-			panic(fmt.Sprintf("无效转义字符: \\%c 在行 %d:%d", l.currentChar, l.line, l.column))
+		// 八进制转义（包括 \0）会自行前进，不需要再移过转义字符。
+		if isOctalDigit(l.currentChar) {
+			value = string([]byte{l.readOctalEscape()})
+		} else {
+			switch l.currentChar {
+			case 'n':
+				value = "\n"
+			case 't':
+				value = "\t"
+			case 'r':
+				value = "\r"
+			case '\'':
+				value = "'"
+			case '\\':
+				value = "\\"
+			default:
+				// 如果是未知的转义序列，则引发恐慌（panic）。
+				panic(newError(l.line, l.column, "无效转义字符: \\%c 在行 %d:%d", l.currentChar, l.line, l.column))
+			}
+			l.advance() // 移过转义字符本身。
 		}
-		l.advance() // 移过转义字符本身。
 	} else {
 		// 如果不是转义字符，则直接读取该字符。
 		value = string(l.currentChar)
@@ -160,7 +274,7 @@ func (l *Lexer) readChar() Token {
 
 	// 检查字符字面量是否以单引号正确闭合。
 	if l.currentChar != '\'' {
-		panic(fmt.Sprintf("字符未闭合，起始于行 %d:%d", startLine, startCol))
+		panic(newError(startLine, startCol, "字符未闭合，起始于行 %d:%d", startLine, startCol))
 	}
 	l.advance() // 跳过闭合的单引号。
 	// 返回 CharConst 类型的 Token。
@@ -177,7 +291,11 @@ func (l *Lexer) readString() Token {
 	// 循环读取字符，直到遇到闭合的双引号或文件末尾。
 	for l.currentChar != '"' && l.currentChar != 0 {
 		// 处理转义字符。
-		if l.currentChar == '\\' {
+		if l.currentChar == '\\' && isOctalDigit(l.peekChar()) {
+			l.advance() // 跳过反斜杠。
+			// 八进制转义（包括 \0）按字节追加，允许字符串中出现空字节。
+			value += string([]byte{l.readOctalEscape()})
+		} else if l.currentChar == '\\' {
 			l.advance() // 跳过反斜杠。
 			switch l.currentChar {
 			case 'n':
@@ -192,7 +310,7 @@ func (l *Lexer) readString() Token {
 				value += "\\"
 			default:
 				// 抛出无效转义字符的错误。
-				panic(fmt.Sprintf("Invalid escape: \\%c at %d:%d", l.currentChar, l.line, l.column))
+				panic(newError(l.line, l.column, "Invalid escape: \\%c at %d:%d", l.currentChar, l.line, l.column))
 			}
 			l.advance() // 移过转义字符本身。
 		} else {
@@ -204,16 +322,60 @@ func (l *Lexer) readString() Token {
 
 	// 检查字符串是否以双引号正确闭合。
 	if l.currentChar != '"' {
-		panic(fmt.Sprintf("Unclosed string at %d:%d", startLine, startCol))
+		panic(newError(startLine, startCol, "Unclosed string at %d:%d", startLine, startCol))
 	}
 	l.advance() // 跳过闭合的双引号。
 	// 返回 STRING 类型的 Token。
 	return Token{STRING, value, startLine, startCol}
 }
 
+// EnableRecovery 开启错误恢复：NextToken 遇到词法错误时记录错误、
+// 跳过出错的部分并继续返回后面的词法单元，而不是引发恐慌。
+// 记录的错误通过 Errors 获取，用于一次报告源代码中的全部错误。
+func (l *Lexer) EnableRecovery() {
+	l.recovery = true
+}
+
+// Errors 返回错误恢复模式下记录的词法错误。
+func (l *Lexer) Errors() []*Error {
+	return l.errors
+}
+
 // NextToken 是词法分析器的核心方法。
 // 每次调用，它都会从源代码中解析并返回下一个 Token。
+// 遇到词法错误时以 *Error 引发恐慌，开启错误恢复时则记录错误并继续。
 func (l *Lexer) NextToken() Token {
+	if !l.recovery {
+		return l.nextToken()
+	}
+	for {
+		if token, ok := l.tryNextToken(); ok {
+			return token
+		}
+	}
+}
+
+// tryNextToken 读取下一个 Token，遇到词法错误时记录错误并返回 false。
+func (l *Lexer) tryNextToken() (token Token, ok bool) {
+	start := l.pos // 记录起始位置，保证出错后至少前进一个字符，避免死循环。
+	defer func() {
+		if r := recover(); r != nil {
+			err, isLexError := r.(*Error)
+			if !isLexError {
+				panic(r) // 不是词法错误，继续向上传递。
+			}
+			l.errors = append(l.errors, err)
+			if l.pos == start {
+				l.advance()
+			}
+			ok = false
+		}
+	}()
+	return l.nextToken(), true
+}
+
+// nextToken 解析并返回下一个 Token，遇到词法错误时引发恐慌。
+func (l *Lexer) nextToken() Token {
 	// 主循环，只要没到文件末尾就一直运行。
 	for l.currentChar != 0 {
 		// 如果是空白字符，则跳过。
@@ -221,6 +383,18 @@ func (l *Lexer) NextToken() Token {
 			l.skipWhitespace()
 			continue // 继续下一次循环，获取下一个非空白字符。
 		}
+		// 如果是 "//"，跳过单行注释。
+		if l.currentChar == '/' && l.peekChar() == '/' {
+			l.skipLineComment()
+			continue
+		}
+
+		// 如果是 "/*"，跳过块注释。
+		if l.currentChar == '/' && l.peekChar() == '*' {
+			l.skipBlockComment()
+			continue
+		}
+
 		// 如果是单引号，开始解析字符字面量。
 		if l.currentChar == '\'' {
 			return l.readChar()
@@ -275,11 +449,21 @@ func (l *Lexer) NextToken() Token {
 		case '+':
 			return Token{PLUS, "+", currentLine, currentCol}
 		case '-':
-			return Token{MINUS, "-", currentLine, currentCol}
+			if l.currentChar == '>' { // 检查是否是 "->"
+				l.advance()
+				return Token{ARROW, "->", currentLine, currentCol}
+			}
+			return Token{MINUS, "-", currentLine, currentCol} // 否则是 "-"
 		case '*':
-			return Token{MULTIPLY, "*", currentLine, currentCol}
+			if l.currentChar == '*' { // 检查是否是 "**"
+				l.advance()
+				return Token{POWER, "**", currentLine, currentCol}
+			}
+			return Token{MULTIPLY, "*", currentLine, currentCol} // 否则是 "*"
 		case '/':
 			return Token{DIVIDE, "/", currentLine, currentCol}
+		case '%':
+			return Token{MODULO, "%", currentLine, currentCol}
 		case ';':
 			return Token{SEMICOLON, ";", currentLine, currentCol}
 		case ',':
@@ -300,7 +484,7 @@ func (l *Lexer) NextToken() Token {
 			return Token{COLON, ":", currentLine, currentCol}
 		default:
 			// 如果遇到无法识别的字符，则引发恐慌。
-			panic(fmt.Sprintf("Unexpected character: %c at %d:%d", currentChar, currentLine, currentCol))
+			panic(newError(currentLine, currentCol, "Unexpected character: %c at %d:%d", currentChar, currentLine, currentCol))
 		}
 	}
 
@@ -0,0 +1,54 @@
+package lexer
+
+import (
+	"fmt"     // 导入 fmt 包，用于构造预处理错误信息。
+	"strings" // 导入 strings 包，用于按行切分和拼接源代码。
+)
+
+// Preprocess 是词法分析之前的预处理步骤。
+// 它识别以 "#if NAME" 开始、以 "#endif" 结束的条件编译区域：
+// 只有当 NAME 出现在 defines 中时，区域内的代码才会被保留。
+// 被跳过的行以及指令行本身都会被替换为空行，从而保证后续词法单元的行号不变。
+func Preprocess(input string, defines map[string]bool) (string, error) {
+	lines := strings.Split(input, "\n")
+	// active 记录每一层 #if 是否处于启用状态，支持嵌套。
+	var active []bool
+	// ifLines 记录每一层 #if 所在的行号，用于报告未闭合的区域。
+	var ifLines []int
+
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && strings.HasPrefix(fields[0], "#") {
+			switch fields[0] {
+			case "#if":
+				if len(fields) != 2 {
+					return "", fmt.Errorf("预处理错误: #if 需要一个名称，在行 %d", i+1)
+				}
+				// 外层区域被跳过时，内层区域也一律跳过。
+				enabled := defines[fields[1]] && (len(active) == 0 || active[len(active)-1])
+				active = append(active, enabled)
+				ifLines = append(ifLines, i+1)
+			case "#endif":
+				if len(active) == 0 {
+					return "", fmt.Errorf("预处理错误: 多余的 #endif，在行 %d", i+1)
+				}
+				active = active[:len(active)-1]
+				ifLines = ifLines[:len(ifLines)-1]
+			default:
+				return "", fmt.Errorf("预处理错误: 未知指令 %s，在行 %d", fields[0], i+1)
+			}
+			lines[i] = "" // 指令行本身不参与词法分析。
+			continue
+		}
+
+		// 处于未启用区域内的行被清空。
+		if len(active) > 0 && !active[len(active)-1] {
+			lines[i] = ""
+		}
+	}
+
+	if len(active) != 0 {
+		return "", fmt.Errorf("预处理错误: #if 未闭合，起始于行 %d", ifLines[len(ifLines)-1])
+	}
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,13 @@
+package lexer
+
+// CountTokens 对输入进行完整的词法分析，统计每种词法单元类型出现的次数。
+// 结尾的 EOF 词法单元不计入统计。
+func CountTokens(input string) map[TokenType]int {
+	counts := map[TokenType]int{}
+	l := New(input)
+	// 循环读取词法单元，直到文件末尾。
+	for token := l.NextToken(); token.Type != EOF; token = l.NextToken() {
+		counts[token.Type]++
+	}
+	return counts
+}
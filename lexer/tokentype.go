@@ -59,6 +59,18 @@ const (
 
 	// EOF 特殊类型 (45)
 	EOF // 45: 文件结束标志
+
+	// ARROW 扩展运算符类型 (46-48)
+	ARROW  // 46: 箭头运算符（->）
+	POWER  // 47: 乘方运算符（**）
+	MODULO // 48: 取模运算符（%）
+
+	// FLOAT 扩展字面量类型 (49)
+	FLOAT // 49: 浮点数常量
+
+	// TRUE 扩展关键字类型 (50-51)
+	TRUE  // 50: true关键字
+	FALSE // 51: false关键字
 )
 
 // 词法单元类型到输出代码的映射表
@@ -109,6 +121,68 @@ var tokenTypeCodes = map[TokenType]string{
 	LeftBrack:  "LBRACK",     // 43
 	RightBrack: "RBRACK",     // 44
 	EOF:        "EOF",        // 45: 文件结束标志
+	ARROW:      "ARROW",      // 46: 箭头运算符
+	POWER:      "POW",        // 47: 乘方运算符
+	MODULO:     "MOD",        // 48: 取模运算符
+	FLOAT:      "FLOATCON",   // 49: 浮点数常量
+	TRUE:       "TRUETK",     // 50
+	FALSE:      "FALSETK",    // 51
+}
+
+// 词法单元类型到面向用户的显示名称的映射表，用于错误信息
+var tokenDisplayNames = map[TokenType]string{
+	PUBLIC:     "'public'",
+	CLASS:      "'class'",
+	STATIC:     "'static'",
+	VOID:       "'void'",
+	MAIN:       "'main'",
+	CHAR:       "'char'",
+	INT:        "'int'",
+	PRINTF:     "'printf'",
+	SCANF:      "'scanf'",
+	SWITCH:     "'switch'",
+	CASE:       "'case'",
+	DEFAULT:    "'default'",
+	FOR:        "'for'",
+	IF:         "'if'",
+	ELSE:       "'else'",
+	WHILE:      "'while'",
+	DO:         "'do'",
+	RETURN:     "'return'",
+	BREAK:      "'break'",
+	CONTINUE:   "'continue'",
+	IDENTIFIER: "identifier",
+	STRING:     "string literal",
+	CharConst:  "character literal",
+	NUMBER:     "integer literal",
+	ASSIGN:     "'='",
+	PLUS:       "'+'",
+	MINUS:      "'-'",
+	MULTIPLY:   "'*'",
+	DIVIDE:     "'/'",
+	LESS:       "'<'",
+	LessEqual:  "'<='",
+	GREAT:      "'>'",
+	GreatEqual: "'>='",
+	NOTEQ:      "'!='",
+	NOT:        "'!'",
+	EQUAL:      "'=='",
+	COMMA:      "','",
+	SEMICOLON:  "';'",
+	COLON:      "':'",
+	LeftParen:  "'('",
+	RightParen: "')'",
+	LeftBrace:  "'{'",
+	RightBrace: "'}'",
+	LeftBrack:  "'['",
+	RightBrack: "']'",
+	EOF:        "end of input",
+	ARROW:      "'->'",
+	POWER:      "'**'",
+	MODULO:     "'%'",
+	FLOAT:      "float literal",
+	TRUE:       "'true'",
+	FALSE:      "'false'",
 }
 
 // Code 返回词法单元类型的标准输出代码
@@ -117,3 +191,13 @@ func (tt TokenType) Code() string {
 	// 如果未定义则返回空字符串（但所有类型均已定义）
 	return tokenTypeCodes[tt]
 }
+
+// DisplayName 返回词法单元类型面向用户的显示名称
+// 运算符、分隔符和关键字带引号显示（如 ';'），字面量类使用描述性名称（如 identifier）
+func (tt TokenType) DisplayName() string {
+	if name, ok := tokenDisplayNames[tt]; ok {
+		return name
+	}
+	// 未定义显示名称时退回到输出代码
+	return tt.Code()
+}
@@ -3,91 +3,363 @@ package main
 
 // 导入依赖包
 import (
+	"Butterfly/ast"      // 抽象语法树节点定义
 	"Butterfly/compiler" // 自定义编译器实现
 	"Butterfly/lexer"    // 自定义词法分析器
 	"Butterfly/parser"   // 自定义语法分析器
 	"Butterfly/vm"       // 自定义字节码虚拟机
+	"bufio"              // 提供带缓冲的逐行读取功能
+	"context"            // 提供超时控制
+	"errors"             // 提供错误类型判断
+	"flag"               // 提供命令行参数解析功能
 	"fmt"                // 提供格式化输入输出功能
+	"io"                 // 提供通用的输入输出接口
 	"os"                 // 提供操作系统功能接口和文件操作
+	"sort"               // 提供排序功能
+	"strings"            // 提供字符串处理功能
+	"time"               // 提供时间间隔类型
 )
 
+// 交互模式的输入提示符
+const prompt = ">> "
+
+// session 保存跨多次编译运行共享的状态：符号表、常量池和全局变量
+// 运行文件时只使用一次，交互模式中所有输入行共用同一个 session
+type session struct {
+	symbolTable *compiler.SymbolTable
+	constants   []interface{}
+	globals     []interface{}
+}
+
+// newSession 创建一个没有任何变量和常量的 session
+func newSession() *session {
+	return &session{
+		symbolTable: compiler.NewSymbolTable(),
+		constants:   []interface{}{},
+		globals:     make([]interface{}, vm.GlobalsSize),
+	}
+}
+
+// defineFlags 收集所有 -D 参数，实现 flag.Value 接口以支持重复出现
+type defineFlags map[string]bool
+
+// String 返回已定义名称的字符串表示
+func (d defineFlags) String() string {
+	names := make([]string, 0, len(d))
+	for name := range d {
+		names = append(names, name)
+	}
+	return strings.Join(names, ",")
+}
+
+// Set 记录一个 -D 参数给出的名称
+func (d defineFlags) Set(name string) error {
+	d[name] = true
+	return nil
+}
+
 // 程序主函数
 func main() {
+	// 运行编译器并以其返回值作为进程退出码
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run 执行完整的编译运行流程
+// 程序输出（计算结果、统计信息）写入 stdout，诊断信息（错误、字节码）写入 stderr
+// 返回值为进程退出码：成功为 0，失败为 1
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	// 解析命令行选项
+	flags := flag.NewFlagSet("Butterfly", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	defines := defineFlags{}
+	flags.Var(defines, "D", "定义条件编译名称（可重复使用）")
+	stats := flags.Bool("stats", false, "只统计各类词法单元的数量，不编译执行")
+	tokens := flags.Bool("tokens", false, "只输出词法分析得到的词法单元，不编译执行")
+	symbols := flags.Bool("symbols", false, "只编译并输出符号表，不执行")
+	timeout := flags.Duration("timeout", 0, "程序执行的最长时间（如 2s），超时后报错退出；0 表示不限制")
+	if err := flags.Parse(args); err != nil {
+		return 1 // flag 包已输出错误信息
+	}
+
+	// 没有文件参数时进入交互模式
+	if flags.NArg() == 0 {
+		repl(stdin, stdout, stderr, *timeout)
+		return 0
+	}
+
 	// 验证命令行参数数量
-	if len(os.Args) != 2 {
-		// 参数不足时显示使用说明
-		fmt.Println("用法: go run . <文件名.calc>")
-		return // 终止程序
+	if flags.NArg() != 1 {
+		// 参数过多时显示使用说明
+		fmt.Fprintln(stderr, "用法: go run . [-D 名称] [--timeout 时长] [--stats | --tokens | --symbols] [文件名.calc | -]")
+		return 1 // 终止程序
 	}
 
-	// 获取输入文件路径（第一个命令行参数）
-	filepath := os.Args[1]
+	// 获取输入文件路径（第一个非选项参数，"-" 表示标准输入）
+	filepath := flags.Arg(0)
 
 	// ========== 文件读取阶段 ==========
-	// 使用 os.ReadFile
-	// 读取源文件内容到字节数组
-	data, err := os.ReadFile(filepath)
+	// 读取源文件（或标准输入）内容到字节数组
+	data, err := readSource(filepath, stdin)
 	// 处理文件读取错误
 	if err != nil {
 		// 显示错误详情
-		fmt.Printf("文件读取失败: %s\n", err)
-		return // 终止程序
+		fmt.Fprintf(stderr, "文件读取失败: %s\n", err)
+		return 1 // 终止程序
+	}
+
+	// ========== 预处理阶段 ==========
+	// 根据 -D 定义的名称处理 #if/#endif 条件编译区域
+	source, err := lexer.Preprocess(string(data), defines)
+	// 处理预处理错误
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1 // 终止程序
 	}
 
+	// (统计选项) 输出各类词法单元的数量后退出
+	if *stats {
+		if !printTokenStats(stdout, stderr, source) {
+			return 1
+		}
+		return 0
+	}
+
+	// (词法单元选项) 逐行输出词法单元后退出
+	if *tokens {
+		if !printTokens(stdout, stderr, source) {
+			return 1
+		}
+		return 0
+	}
+
+	// (符号表选项) 编译后输出符号表并退出
+	if *symbols {
+		c, _, ok := compileSource(source, newSession(), stderr)
+		if !ok {
+			return 1
+		}
+		printSymbols(stdout, c.SymbolTable())
+		return 0
+	}
+
+	// 编译并执行，同时输出字节码供调试
+	result, ok := compileAndRun(source, newSession(), *timeout, stdout, stderr, true)
+	if !ok {
+		return 1 // 终止程序
+	}
+
+	// ========== 结果输出阶段 ==========
+	// 格式化输出计算结果（程序不以表达式语句结尾时没有计算结果）
+	if result != nil {
+		fmt.Fprintf(stdout, "计算结果: %v\n", result)
+	}
+	return 0
+}
+
+// compileSource 对源代码依次执行词法分析、语法分析和编译，编译沿用 s 中的符号表和常量池
+// 各阶段的错误写入 stderr，成功时返回完成编译的编译器和抽象语法树，最后一个返回值表示是否成功
+func compileSource(source string, s *session, stderr io.Writer) (c *compiler.Compiler, program *ast.Program, ok bool) {
+	// 词法分析器通过 panic 报告错误，这里将其转换为普通的错误输出
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(stderr, "词法分析错误: %v\n", r)
+			c, program, ok = nil, nil, false
+		}
+	}()
+
 	// ========== 词法分析阶段 ==========
-	// 创建词法分析器实例（将文件内容转为字符串）
-	l := lexer.New(string(data))
+	// 创建词法分析器实例
+	l := lexer.New(source)
 
 	// ========== 语法分析阶段 ==========
 	// 创建语法分析器实例（基于词法分析器）
 	p := parser.New(l)
 	// 解析程序生成抽象语法树(AST)
-	program := p.ParseProgram()
+	program = p.ParseProgram()
 
 	// 检查语法错误集合
 	if len(p.Errors()) != 0 {
 		// 输出错误标题
-		fmt.Println("语法分析错误:")
+		fmt.Fprintln(stderr, "语法分析错误:")
 		// 遍历输出所有错误信息（缩进格式）
 		for _, msg := range p.Errors() {
-			fmt.Println("\t" + msg)
+			fmt.Fprintln(stderr, "\t"+msg)
 		}
-		return // 终止程序
+		return nil, nil, false
 	}
 
 	// ========== 编译阶段 ==========
-	// 初始化编译器实例
-	c := compiler.New()
+	// 初始化编译器实例（沿用 session 中已声明的变量和常量）
+	c = compiler.NewWithState(s.symbolTable, s.constants)
 	// 将抽象语法树编译为字节码
-	err = c.Compile(program)
+	err := c.Compile(program)
+	// 常量池可能扩容为新的切片，成功与否都保存下来，使已分配的索引保持有效
+	s.constants = c.Bytecode().Constants
 	// 处理编译错误
 	if err != nil {
 		// 输出编译错误详情
-		fmt.Printf("编译失败: %s\n", err)
-		return // 终止程序
+		fmt.Fprintf(stderr, "编译失败: %s\n", err)
+		return nil, nil, false
+	}
+
+	// 警告不会中止编译，只输出提示
+	for _, msg := range c.Warnings() {
+		fmt.Fprintf(stderr, "警告: %s\n", msg)
+	}
+	return c, program, true
+}
+
+// compileAndRun 对源代码依次执行词法分析、语法分析、编译和虚拟机执行，
+// 变量和常量在同一个 session 的多次调用之间保留
+// 程序的 printf 输出写入 stdout，各阶段的错误写入 stderr；
+// timeout 大于 0 时限制虚拟机的执行时间；dumpBytecode 为 true 时还会把字节码指令输出到 stderr
+// 成功时若程序以表达式语句结尾，返回该语句的值作为计算结果，否则结果为 nil；
+// 第二个返回值表示是否成功
+func compileAndRun(source string, s *session, timeout time.Duration, stdout, stderr io.Writer, dumpBytecode bool) (interface{}, bool) {
+	c, program, ok := compileSource(source, s, stderr)
+	if !ok {
+		return nil, false
+	}
+
+	// 校验生成的字节码结构是否合法
+	err := vm.Verify(c.Bytecode())
+	if err != nil {
+		fmt.Fprintf(stderr, "字节码校验失败: %s\n", err)
+		return nil, false
 	}
 
 	// (调试选项) 打印字节码指令
-	fmt.Println("字节码指令集:")
-	// 输出字节码指令序列（字符串表示）
-	fmt.Println(c.Bytecode().Instructions)
+	if dumpBytecode {
+		fmt.Fprintln(stderr, "字节码指令集:")
+		// 输出字节码指令序列（字符串表示）
+		fmt.Fprintln(stderr, c.Bytecode().Instructions)
+	}
 
 	// ========== 虚拟机执行阶段 ==========
-	// 初始化虚拟机（传入编译后的字节码）
-	machine := vm.New(c.Bytecode())
-	// 执行字节码指令
-	err = machine.Run()
+	// 初始化虚拟机（传入编译后的字节码和 session 的全局变量存储）
+	machine := vm.NewWithGlobalsStore(c.Bytecode(), s.globals, stdout)
+	// 执行字节码指令（设置了超时时间时超时后停止执行）
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	err = machine.RunContext(ctx)
 	// 处理虚拟机执行错误
+	if errors.Is(err, context.DeadlineExceeded) {
+		fmt.Fprintf(stderr, "虚拟机执行超时: 超过 %s\n", timeout)
+		return nil, false
+	}
 	if err != nil {
 		// 输出执行错误详情
-		fmt.Printf("虚拟机执行失败: %s\n", err)
-		return // 终止程序
+		fmt.Fprintf(stderr, "虚拟机执行失败: %s\n", err)
+		return nil, false
 	}
 
-	// ========== 结果输出阶段 ==========
-	// 获取栈顶元素作为最终计算结果
-	// (函数变更说明：从LastPoppedStackElem()改为StackTop())
-	result := machine.StackTop()
-	// 格式化输出计算结果
-	fmt.Printf("计算结果: %v\n", result)
+	// 其他语句（如 printf、变量声明）也会弹栈，最后弹出的元素只有在
+	// 最后一条语句是表达式语句时才是计算结果
+	n := len(program.Statements)
+	if n == 0 {
+		return nil, true
+	}
+	if _, isExpr := program.Statements[n-1].(*ast.ExpressionStatement); !isExpr {
+		return nil, true
+	}
+
+	// 表达式语句执行后值已被弹出，取最后弹出的元素作为最终计算结果
+	// (函数变更说明：从StackTop()改回LastPoppedStackElem())
+	return machine.LastPoppedStackElem(), true
+}
+
+// repl 交互模式：逐行读取输入并执行，输出每行的计算结果
+// 前面各行声明的变量在后面的行中仍然可用，timeout 限制每一行的执行时间
+// 某一行出错只输出错误信息，不会结束循环；遇到 EOF 或 quit 时退出
+func repl(stdin io.Reader, stdout, stderr io.Writer, timeout time.Duration) {
+	s := newSession()
+	scanner := bufio.NewScanner(stdin)
+	for {
+		fmt.Fprint(stdout, prompt)
+		if !scanner.Scan() {
+			fmt.Fprintln(stdout)
+			return
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "quit" {
+			return
+		}
+		if line == "" {
+			continue
+		}
+
+		if result, ok := compileAndRun(line, s, timeout, stdout, stderr, false); ok && result != nil {
+			fmt.Fprintf(stdout, "%v\n", result)
+		}
+	}
+}
+
+// readSource 读取程序源代码
+// 路径为 "-" 时从 stdin 读取全部内容，否则使用 os.ReadFile 读取文件
+func readSource(path string, stdin io.Reader) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(stdin)
+	}
+	return os.ReadFile(path)
+}
+
+// printTokens 输出词法分析器产生的每个词法单元（包括结尾的 EOF），每行一个
+// 词法错误写入 stderr，返回值表示是否成功
+func printTokens(stdout, stderr io.Writer, source string) (ok bool) {
+	// 词法分析器通过 panic 报告错误
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(stderr, "词法分析错误: %v\n", r)
+			ok = false
+		}
+	}()
+
+	l := lexer.New(source)
+	for {
+		token := l.NextToken()
+		fmt.Fprintln(stdout, token.String())
+		if token.Type == lexer.EOF {
+			return true
+		}
+	}
+}
+
+// printSymbols 按定义顺序输出符号表中每个变量的名称、作用域和槽位索引
+func printSymbols(w io.Writer, table *compiler.SymbolTable) {
+	fmt.Fprintln(w, "符号表:")
+	for _, symbol := range table.Symbols() {
+		fmt.Fprintf(w, "%-10s %s %d\n", symbol.Name, symbol.Scope, symbol.Index)
+	}
+}
+
+// printTokenStats 按词法单元类型顺序输出每种类型的出现次数
+// 词法错误写入 stderr，返回值表示是否成功
+func printTokenStats(stdout, stderr io.Writer, source string) (ok bool) {
+	// 词法分析器通过 panic 报告错误
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(stderr, "词法分析错误: %v\n", r)
+			ok = false
+		}
+	}()
+
+	counts := lexer.CountTokens(source)
+
+	// 按类型枚举值排序，保证输出顺序稳定
+	types := make([]lexer.TokenType, 0, len(counts))
+	for tt := range counts {
+		types = append(types, tt)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+
+	fmt.Fprintln(stdout, "词法单元统计:")
+	for _, tt := range types {
+		fmt.Fprintf(stdout, "%-10s %d\n", tt.Code(), counts[tt])
+	}
+	return true
 }
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestReadSourceStdin 验证路径为 "-" 时从给定的输入流读取源代码
+func TestReadSourceStdin(t *testing.T) {
+	data, err := readSource("-", strings.NewReader("1 + 2"))
+	assert.NoError(t, err)
+	assert.Equal(t, "1 + 2", string(data))
+}
+
+// TestReadSourceFile 验证普通路径从文件读取且不会读取输入流
+func TestReadSourceFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prog.calc")
+	assert.NoError(t, os.WriteFile(path, []byte("3 - 1"), 0o644))
+
+	data, err := readSource(path, strings.NewReader("1 + 2"))
+	assert.NoError(t, err)
+	assert.Equal(t, "3 - 1", string(data))
+}
+
+// runWithInput 以给定参数和标准输入运行程序，分别返回退出码、stdout 和 stderr 的内容
+func runWithInput(args []string, input string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(input), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+// TestRunOutputStreams 验证程序结果写入 stdout，字节码等诊断信息写入 stderr
+func TestRunOutputStreams(t *testing.T) {
+	code, stdout, stderr := runWithInput([]string{"-"}, "1 + 2")
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "计算结果: 3\n", stdout)
+	assert.Contains(t, stderr, "字节码指令集:")
+	assert.Contains(t, stderr, "OpAdd")
+}
+
+// TestRunPrintf 验证 printf 的输出写入 stdout，位于计算结果之前
+func TestRunPrintf(t *testing.T) {
+	code, stdout, _ := runWithInput([]string{"-"}, `printf("x=%d\n", 5); 1`)
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "x=5\n计算结果: 1\n", stdout)
+}
+
+// TestRunPrintfOnly 验证不以表达式语句结尾的程序不输出计算结果
+func TestRunPrintfOnly(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{`printf("hi\n");`, "hi\n"},
+		{`1 + 2; printf("done\n");`, "done\n"},
+		{`int x = 5;`, ""},
+		{"", ""},
+	}
+
+	for _, tc := range testCases {
+		code, stdout, _ := runWithInput([]string{"-"}, tc.input)
+		assert.Equal(t, 0, code, tc.input)
+		assert.Equal(t, tc.expected, stdout, tc.input)
+	}
+
+	_, stdout, _ := runWithInput(nil, "printf(\"hi\\n\")\n1 + 1\n")
+	assert.Equal(t, ">> hi\n>> 2\n>> \n", stdout)
+}
+
+// TestRunWarnings 验证编译警告写入 stderr 而程序照常执行
+func TestRunWarnings(t *testing.T) {
+	code, stdout, stderr := runWithInput([]string{"-"}, "char c = 300; c")
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "计算结果: 300\n", stdout)
+	assert.Contains(t, stderr, "警告: integer 300 out of range for char")
+}
+
+// TestRunErrorsToStderr 验证各阶段的错误只写入 stderr 并返回非零退出码
+func TestRunErrorsToStderr(t *testing.T) {
+	testCases := []struct {
+		name     string
+		args     []string
+		input    string
+		expected string
+	}{
+		{"参数过多", []string{"a.calc", "b.calc"}, "", "用法:"},
+		{"词法错误", []string{"-"}, "1 + @", "词法分析错误:"},
+		{"语法错误", []string{"-"}, "1 +", "语法分析错误:"},
+		{"执行错误", []string{"-"}, "5 % 0", "虚拟机执行失败: runtime error at line 1: modulo by zero"},
+		{"预处理错误", []string{"-"}, "#if FOO\n1", "#if 未闭合"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			code, stdout, stderr := runWithInput(tc.args, tc.input)
+			assert.Equal(t, 1, code)
+			assert.Empty(t, stdout)
+			assert.Contains(t, stderr, tc.expected)
+		})
+	}
+}
+
+// TestREPL 验证交互模式逐行执行，出错的行不会中断循环，quit 之后的输入被忽略
+func TestREPL(t *testing.T) {
+	input := "1 + 2\n5 % 0\n\n1 + @\n2 * 3\nquit\n4\n"
+	code, stdout, stderr := runWithInput([]string{}, input)
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, ">> 3\n>> >> >> >> 6\n>> ", stdout)
+	assert.Contains(t, stderr, "虚拟机执行失败: runtime error at line 1: modulo by zero")
+	assert.Contains(t, stderr, "词法分析错误:")
+	assert.NotContains(t, stderr, "字节码指令集:")
+}
+
+// TestREPLVariables 验证交互模式中前面各行声明的变量在后面的行中仍然可用
+func TestREPLVariables(t *testing.T) {
+	input := "int x = 5;\nx + 1\nx = x * 2;\nprintf(\"%d\\n\", x);\nint x;\nx\n"
+	code, stdout, stderr := runWithInput([]string{}, input)
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, ">> >> 6\n>> 10\n>> 10\n>> >> 10\n>> \n", stdout)
+	assert.Contains(t, stderr, "编译失败: variable x already declared")
+}
+
+// TestREPLEndOfInput 验证交互模式在输入结束时正常退出
+func TestREPLEndOfInput(t *testing.T) {
+	code, stdout, _ := runWithInput([]string{}, "2 ** 3")
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, ">> 8\n>> \n", stdout)
+}
+
+// TestRunSymbols 验证 --symbols 按定义顺序输出全局变量而不执行程序
+func TestRunSymbols(t *testing.T) {
+	code, stdout, _ := runWithInput([]string{"--symbols", "-"}, "int x = 1; char c = 'a'; int y = x; x = 1 / 0;")
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "符号表:\nx          GLOBAL 0\nc          GLOBAL 1\ny          GLOBAL 2\n", stdout)
+
+	code, _, stderr := runWithInput([]string{"--symbols", "-"}, "z + 1")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "编译失败: undefined variable z")
+}
+
+// TestRunStats 验证 --stats 输出各类词法单元的数量，词法错误时返回非零退出码
+func TestRunStats(t *testing.T) {
+	code, stdout, _ := runWithInput([]string{"--stats", "-"}, "1 + 2 + x")
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "词法单元统计:\nIDENFR     1\nINTCON     2\nPLUS       2\n", stdout)
+
+	code, stdout, stderr := runWithInput([]string{"--stats", "-"}, "1 + @")
+	assert.Equal(t, 1, code)
+	assert.Empty(t, stdout)
+	assert.Contains(t, stderr, "词法分析错误:")
+}
+
+// TestRunDefines 验证 -D 定义的名称会启用对应的 #if 区域，未定义时区域被跳过
+func TestRunDefines(t *testing.T) {
+	input := "1\n#if FOO\n+ 1\n#endif\n"
+
+	code, stdout, _ := runWithInput([]string{"-D", "FOO", "-"}, input)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "计算结果: 2\n", stdout)
+
+	code, stdout, _ = runWithInput([]string{"-"}, input)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "计算结果: 1\n", stdout)
+}
+
+// TestRunTimeout 验证 --timeout 限制程序的执行时间，超时后报错并返回非零退出码
+func TestRunTimeout(t *testing.T) {
+	code, stdout, stderr := runWithInput([]string{"--timeout", "50ms", "-"}, "while (true) {}")
+	assert.Equal(t, 1, code)
+	assert.Empty(t, stdout)
+	assert.Contains(t, stderr, "虚拟机执行超时: 超过 50ms")
+
+	// 在时限内结束的程序不受影响
+	code, stdout, _ = runWithInput([]string{"--timeout=2s", "-"}, "int i = 0; while (i < 100) { i = i + 1; } i")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "计算结果: 100\n", stdout)
+
+	// 交互模式中超时只结束当前行
+	code, stdout, stderr = runWithInput([]string{"--timeout=50ms"}, "while (true) {}\n1 + 1\n")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, ">> >> 2\n>> \n", stdout)
+	assert.Contains(t, stderr, "虚拟机执行超时")
+}
+
+// TestRunTokens 验证 --tokens 只输出词法单元而不编译执行
+func TestRunTokens(t *testing.T) {
+	code, stdout, stderr := runWithInput([]string{"--tokens", "-"}, "int a = 1 +")
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "INTTK    int\nIDENFR   a\nASSIGN   =\nINTCON   1\nPLUS     +\nEOF      \n", stdout)
+	assert.Empty(t, stderr)
+
+	code, _, stderr = runWithInput([]string{"--tokens", "-"}, "1 @")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "词法分析错误:")
+}
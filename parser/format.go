@@ -0,0 +1,122 @@
+package parser
+
+import (
+	"Butterfly/ast"
+	"strings"
+)
+
+// atomic 是字面量、标识符等不可再分的表达式的优先级，高于所有运算符
+const atomic = PREFIX + 1
+
+// Format 将语法树打印为源代码，只保留按优先级和结合性必需的括号，
+// 例如 ((1 + 2)) 和 1 + 2 打印结果相同，而 (1 + 2) * 3 保留括号。
+// 与 String() 的完整括号形式不同，打印结果可以重新解析得到相同的语法树。
+// 优先级取自解析器的运算符表，因此通过 RegisterInfix 注册的运算符同样适用。
+func (p *Parser) Format(node ast.Node) string {
+	switch node := node.(type) {
+	case nil:
+		return ""
+	case *ast.Program:
+		return p.formatStatements(node.Statements)
+	case ast.Statement:
+		return p.formatStatement(node)
+	case ast.Expression:
+		s, _ := p.formatExpression(node)
+		return s
+	}
+	return node.String()
+}
+
+// formatStatements 依次打印语句，以空格分隔
+func (p *Parser) formatStatements(stmts []ast.Statement) string {
+	out := make([]string, len(stmts))
+	for i, s := range stmts {
+		out[i] = p.formatStatement(s)
+	}
+	return strings.Join(out, " ")
+}
+
+// formatStatement 打印一条语句，语句中的表达式只保留必需的括号
+func (p *Parser) formatStatement(stmt ast.Statement) string {
+	switch stmt := stmt.(type) {
+	case *ast.ExpressionStatement:
+		if stmt.Expression == nil {
+			return ""
+		}
+		return p.Format(stmt.Expression) + ";"
+	case *ast.LetStatement:
+		out := stmt.TokenLiteral() + " " + stmt.Name.Value
+		if stmt.Value != nil {
+			out += " = " + p.Format(stmt.Value)
+		}
+		return out + ";"
+	case *ast.BlockStatement:
+		return "{" + p.formatStatements(stmt.Statements) + "}"
+	case *ast.IfStatement:
+		out := "if (" + p.Format(stmt.Condition) + ") " + p.Format(stmt.Consequence)
+		if stmt.Alternative != nil {
+			out += " else " + p.Format(stmt.Alternative)
+		}
+		return out
+	case *ast.WhileStatement:
+		return "while (" + p.Format(stmt.Condition) + ") " + p.Format(stmt.Body)
+	case *ast.ForStatement:
+		out := "for ("
+		if stmt.Init != nil {
+			out += strings.TrimSuffix(p.Format(stmt.Init), ";")
+		}
+		out += "; "
+		if stmt.Condition != nil {
+			out += p.Format(stmt.Condition)
+		}
+		out += "; "
+		if stmt.Post != nil {
+			out += p.Format(stmt.Post)
+		}
+		return out + ") " + p.Format(stmt.Body)
+	case *ast.PrintfStatement:
+		args := []string{p.Format(stmt.Format)}
+		for _, a := range stmt.Arguments {
+			args = append(args, p.Format(a))
+		}
+		return "printf(" + strings.Join(args, ", ") + ");"
+	}
+	return stmt.String()
+}
+
+// formatExpression 打印表达式，并返回其最外层运算符的优先级，
+// 由外层表达式决定是否需要为它加括号
+func (p *Parser) formatExpression(exp ast.Expression) (string, int) {
+	switch exp := exp.(type) {
+	case *ast.InfixExpression:
+		precedence, ok := p.precedences[exp.Token.Type]
+		if !ok {
+			// 不在运算符表中的运算符无法判断优先级，保留完整括号
+			return exp.String(), atomic
+		}
+		// 左结合运算符的右操作数、右结合运算符的左操作数与自身同级时需要括号
+		leftMin, rightMin := precedence, precedence+1
+		if p.rightAssoc[exp.Token.Type] {
+			leftMin, rightMin = precedence+1, precedence
+		}
+		return p.formatOperand(exp.Left, leftMin) + " " + exp.Operator + " " + p.formatOperand(exp.Right, rightMin), precedence
+	case *ast.PrefixExpression:
+		// 前缀运算符的操作数可以包含乘方，因此前缀表达式作为乘方的左操作数时需要括号
+		return exp.Operator + p.formatOperand(exp.Right, POWER), POWER
+	case *ast.CastExpression:
+		return "(" + exp.Type.Value + ")" + p.formatOperand(exp.Right, PREFIX), PREFIX
+	case *ast.AssignExpression:
+		// 赋值为右结合，右侧的赋值不需要括号
+		return exp.Name.Value + " = " + p.formatOperand(exp.Value, ASSIGN), ASSIGN
+	}
+	return exp.String(), atomic
+}
+
+// formatOperand 打印操作数，优先级低于 min 时加上括号
+func (p *Parser) formatOperand(exp ast.Expression, min int) string {
+	s, precedence := p.formatExpression(exp)
+	if precedence < min {
+		return "(" + s + ")"
+	}
+	return s
+}
@@ -5,18 +5,102 @@ import (
 	"Butterfly/lexer"
 	"fmt"
 	"strconv"
+	"unicode/utf8"
 )
 
+// 运算符优先级，数值越大绑定越紧
+const (
+	_ int = iota
+	LOWEST
+	ASSIGN      // =
+	EQUALS      // == !=
+	LESSGREATER // < > <= >=
+	SUM         // + -
+	PRODUCT     // * / %
+	POWER       // **
+	PREFIX      // !x -x
+)
+
+// 默认的中缀运算符优先级表
+var precedences = map[lexer.TokenType]int{
+	lexer.EQUAL:      EQUALS,
+	lexer.NOTEQ:      EQUALS,
+	lexer.LESS:       LESSGREATER,
+	lexer.GREAT:      LESSGREATER,
+	lexer.LessEqual:  LESSGREATER,
+	lexer.GreatEqual: LESSGREATER,
+	lexer.PLUS:       SUM,
+	lexer.MINUS:      SUM,
+	lexer.MULTIPLY:   PRODUCT,
+	lexer.DIVIDE:     PRODUCT,
+	lexer.MODULO:     PRODUCT,
+	lexer.POWER:      POWER,
+}
+
+// 默认的右结合运算符，其余运算符均为左结合
+var rightAssociative = map[lexer.TokenType]bool{
+	lexer.POWER: true,
+}
+
+type (
+	prefixParseFn func() ast.Expression
+	infixParseFn  func(ast.Expression) ast.Expression
+)
+
+// Error 是一条带位置的语法错误，Message 不含 Errors() 中的位置前缀
+type Error struct {
+	Line    int
+	Column  int
+	Message string
+}
+
 type Parser struct {
-	l      *lexer.Lexer
-	errors []string
+	l       *lexer.Lexer
+	errors  []string
+	details []Error // 与 errors 一一对应的结构化错误
 
 	curToken  lexer.Token
 	peekToken lexer.Token
+
+	// 解析函数表和优先级表，驱动 Pratt 解析循环
+	prefixParseFns map[lexer.TokenType]prefixParseFn
+	infixParseFns  map[lexer.TokenType]infixParseFn
+	precedences    map[lexer.TokenType]int
+	rightAssoc     map[lexer.TokenType]bool
 }
 
 func New(l *lexer.Lexer) *Parser {
-	p := &Parser{l: l, errors: []string{}}
+	p := &Parser{
+		l:              l,
+		errors:         []string{},
+		prefixParseFns: map[lexer.TokenType]prefixParseFn{},
+		infixParseFns:  map[lexer.TokenType]infixParseFn{},
+		precedences:    map[lexer.TokenType]int{},
+		rightAssoc:     map[lexer.TokenType]bool{},
+	}
+
+	p.registerPrefix(lexer.IDENTIFIER, p.parseIdentifier)
+	p.registerPrefix(lexer.NUMBER, p.parseIntegerLiteral)
+	p.registerPrefix(lexer.FLOAT, p.parseFloatLiteral)
+	p.registerPrefix(lexer.CharConst, p.parseCharLiteral)
+	p.registerPrefix(lexer.STRING, p.parseStringLiteral)
+	p.registerPrefix(lexer.LeftParen, p.parseGroupedExpression)
+	p.registerPrefix(lexer.TRUE, p.parseBooleanLiteral)
+	p.registerPrefix(lexer.FALSE, p.parseBooleanLiteral)
+	p.registerPrefix(lexer.NOT, p.parsePrefixExpression)
+	p.registerPrefix(lexer.MINUS, p.parsePrefixExpression)
+
+	// 赋值为右结合，x = y = 1 先对 y 赋值；左侧必须是变量名，因此单独注册
+	p.registerInfix(lexer.ASSIGN, ASSIGN, p.parseAssignExpression)
+
+	for tokenType, precedence := range precedences {
+		if rightAssociative[tokenType] {
+			p.RegisterRightInfix(tokenType, precedence)
+		} else {
+			p.RegisterInfix(tokenType, precedence)
+		}
+	}
+
 	// 读取两个token，以填充 curToken 和 peekToken
 	p.nextToken()
 	p.nextToken()
@@ -27,36 +111,403 @@ func (p *Parser) Errors() []string {
 	return p.errors
 }
 
+// ErrorDetails 以结构化的形式返回语法错误，与 Errors() 的顺序一致
+func (p *Parser) ErrorDetails() []Error {
+	return p.details
+}
+
+// expectError 以统一格式记录期望与实际词法单元不符的错误，
+// 如 expected ')', found ';'
+func (p *Parser) expectError(expected lexer.TokenType, found lexer.Token) {
+	p.errorAt(found, "expected %s, found %s", expected.DisplayName(), foundName(found))
+}
+
+// foundName 返回错误信息中实际遇到的词法单元：显示其源码值，文件末尾显示为 end of input
+func foundName(tok lexer.Token) string {
+	if tok.Type == lexer.EOF {
+		return tok.Type.DisplayName()
+	}
+	return "'" + tok.Value + "'"
+}
+
+// expectPeek 检查下一个词法单元的类型：匹配时前进一个词法单元并返回 true，
+// 否则记录 expected X, found Y 形式的错误并返回 false
+func (p *Parser) expectPeek(t lexer.TokenType) bool {
+	if p.peekToken.Type != t {
+		p.expectError(t, p.peekToken)
+		return false
+	}
+	p.nextToken()
+	return true
+}
+
+// addError 记录一条语法错误，并在前面加上当前词法单元的位置，
+// 如 parse error at 3:5: could not parse "9x" as integer
+func (p *Parser) addError(format string, args ...interface{}) {
+	p.errorAt(p.curToken, format, args...)
+}
+
+// errorAt 记录一条语法错误，位置取自给定的词法单元
+func (p *Parser) errorAt(tok lexer.Token, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	p.errors = append(p.errors, fmt.Sprintf("parse error at %d:%d: ", tok.Line, tok.Column)+msg)
+	p.details = append(p.details, Error{Line: tok.Line, Column: tok.Column, Message: msg})
+}
+
+func (p *Parser) registerPrefix(tokenType lexer.TokenType, fn prefixParseFn) {
+	p.prefixParseFns[tokenType] = fn
+}
+
+func (p *Parser) registerInfix(tokenType lexer.TokenType, precedence int, fn infixParseFn) {
+	p.infixParseFns[tokenType] = fn
+	p.precedences[tokenType] = precedence
+}
+
+// RegisterInfix 以指定优先级注册一个左结合的二元运算符，
+// 解析结果为以该词法单元值为运算符的 InfixExpression
+func (p *Parser) RegisterInfix(tokenType lexer.TokenType, precedence int) {
+	p.registerInfix(tokenType, precedence, p.parseInfixExpression)
+	delete(p.rightAssoc, tokenType)
+}
+
+// RegisterRightInfix 与 RegisterInfix 相同，但注册的运算符为右结合，
+// 例如 2 ** 3 ** 2 解析为 2 ** (3 ** 2)
+func (p *Parser) RegisterRightInfix(tokenType lexer.TokenType, precedence int) {
+	p.registerInfix(tokenType, precedence, p.parseInfixExpression)
+	p.rightAssoc[tokenType] = true
+}
+
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
 }
 
+func (p *Parser) peekPrecedence() int {
+	if prec, ok := p.precedences[p.peekToken.Type]; ok {
+		return prec
+	}
+	return LOWEST
+}
+
+func (p *Parser) curPrecedence() int {
+	if prec, ok := p.precedences[p.curToken.Type]; ok {
+		return prec
+	}
+	return LOWEST
+}
+
 func (p *Parser) ParseProgram() *ast.Program {
-	program := &ast.Program{}
-	program.Expression = p.parseExpression()
+	program := &ast.Program{Statements: []ast.Statement{}}
+
+	for p.curToken.Type != lexer.EOF {
+		stmt := p.parseStatement()
+		if stmt != nil {
+			program.Statements = append(program.Statements, stmt)
+		}
+		p.nextToken()
+	}
 	return program
 }
 
+// 解析语句，单独的分号是空语句，直接跳过
+func (p *Parser) parseStatement() ast.Statement {
+	switch p.curToken.Type {
+	case lexer.SEMICOLON:
+		return nil
+	case lexer.INT, lexer.CHAR:
+		return p.parseLetStatement()
+	case lexer.IF:
+		return p.parseIfStatement()
+	case lexer.WHILE:
+		return p.parseWhileStatement()
+	case lexer.FOR:
+		return p.parseForStatement()
+	case lexer.PRINTF:
+		return p.parsePrintfStatement()
+	case lexer.BREAK:
+		stmt := &ast.BreakStatement{Token: p.curToken}
+		if p.peekToken.Type == lexer.SEMICOLON {
+			p.nextToken()
+		}
+		return stmt
+	case lexer.CONTINUE:
+		stmt := &ast.ContinueStatement{Token: p.curToken}
+		if p.peekToken.Type == lexer.SEMICOLON {
+			p.nextToken()
+		}
+		return stmt
+	case lexer.LeftBrace:
+		// 解析失败时返回无类型的 nil，避免得到包含 nil 指针的非 nil 接口
+		if block := p.parseBlockStatement(); block != nil {
+			return block
+		}
+		return nil
+	default:
+		return p.parseExpressionStatement()
+	}
+}
+
+// 解析变量声明语句：类型 名称 [= 表达式];
+func (p *Parser) parseLetStatement() ast.Statement {
+	stmt := &ast.LetStatement{Token: p.curToken}
+
+	if !p.expectPeek(lexer.IDENTIFIER) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Value}
+
+	if p.peekToken.Type == lexer.ASSIGN {
+		p.nextToken() // 移动到 =
+		p.nextToken() // 移动到初始值表达式
+		stmt.Value = p.parseExpression(LOWEST)
+	}
+
+	if p.peekToken.Type == lexer.SEMICOLON {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// 解析条件语句：if (条件) { ... } [else { ... }]
+// else 后面紧跟 if 时，该 if 语句作为 else 分支中唯一的语句
+func (p *Parser) parseIfStatement() ast.Statement {
+	stmt := &ast.IfStatement{Token: p.curToken}
+
+	if !p.expectPeek(lexer.LeftParen) {
+		return nil
+	}
+	p.nextToken() // 移动到条件表达式
+
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(lexer.RightParen) {
+		return nil
+	}
+
+	if !p.expectPeek(lexer.LeftBrace) {
+		return nil
+	}
+
+	stmt.Consequence = p.parseBlockStatement()
+	if stmt.Consequence == nil {
+		return nil
+	}
+
+	if p.peekToken.Type != lexer.ELSE {
+		return stmt
+	}
+	p.nextToken() // 移动到 else
+
+	switch p.peekToken.Type {
+	case lexer.IF:
+		p.nextToken() // 移动到 if
+		block := &ast.BlockStatement{Token: p.curToken}
+		nested := p.parseIfStatement()
+		if nested == nil {
+			return nil
+		}
+		block.Statements = []ast.Statement{nested}
+		stmt.Alternative = block
+	case lexer.LeftBrace:
+		p.nextToken() // 移动到 {
+		stmt.Alternative = p.parseBlockStatement()
+		if stmt.Alternative == nil {
+			return nil
+		}
+	default:
+		p.expectError(lexer.LeftBrace, p.peekToken)
+		return nil
+	}
+	return stmt
+}
+
+// 解析循环语句：while (条件) { ... }
+func (p *Parser) parseWhileStatement() ast.Statement {
+	stmt := &ast.WhileStatement{Token: p.curToken}
+
+	if !p.expectPeek(lexer.LeftParen) {
+		return nil
+	}
+	p.nextToken() // 移动到条件表达式
+
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(lexer.RightParen) {
+		return nil
+	}
+
+	if !p.expectPeek(lexer.LeftBrace) {
+		return nil
+	}
+
+	stmt.Body = p.parseBlockStatement()
+	if stmt.Body == nil {
+		return nil
+	}
+	return stmt
+}
+
+// 解析 for 循环语句：for ([初始化]; [条件]; [更新]) { ... }
+// 初始化子句只能是变量声明或表达式，条件省略时为无限循环
+func (p *Parser) parseForStatement() ast.Statement {
+	stmt := &ast.ForStatement{Token: p.curToken}
+
+	if !p.expectPeek(lexer.LeftParen) {
+		return nil
+	}
+	p.nextToken() // 移动到初始化子句
+
+	// 初始化子句解析结束后，存在分号时 curToken 停在分号上
+	if p.curToken.Type != lexer.SEMICOLON {
+		switch {
+		case p.curToken.Type == lexer.INT || p.curToken.Type == lexer.CHAR:
+			stmt.Init = p.parseLetStatement()
+		case p.prefixParseFns[p.curToken.Type] != nil:
+			if init := p.parseExpressionStatement(); init.Expression != nil {
+				stmt.Init = init
+			}
+		default:
+			// 其他语句（printf、if、语句块等）不能作为初始化子句
+			p.addError("expected declaration or expression, found %s", foundName(p.curToken))
+		}
+		if stmt.Init == nil {
+			return nil
+		}
+		if p.curToken.Type != lexer.SEMICOLON {
+			p.expectError(lexer.SEMICOLON, p.peekToken)
+			return nil
+		}
+	}
+	p.nextToken() // 移动到条件子句
+
+	if p.curToken.Type != lexer.SEMICOLON {
+		stmt.Condition = p.parseExpression(LOWEST)
+		if !p.expectPeek(lexer.SEMICOLON) {
+			return nil
+		}
+	}
+	p.nextToken() // 移动到更新子句
+
+	if p.curToken.Type != lexer.RightParen {
+		stmt.Post = p.parseExpression(LOWEST)
+		if !p.expectPeek(lexer.RightParen) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(lexer.LeftBrace) {
+		return nil
+	}
+
+	stmt.Body = p.parseBlockStatement()
+	if stmt.Body == nil {
+		return nil
+	}
+	return stmt
+}
+
+// 解析输出语句：printf(格式, 参数...)
+func (p *Parser) parsePrintfStatement() ast.Statement {
+	stmt := &ast.PrintfStatement{Token: p.curToken}
+
+	if !p.expectPeek(lexer.LeftParen) {
+		return nil
+	}
+	p.nextToken() // 移动到格式字符串
+
+	stmt.Format = p.parseExpression(LOWEST)
+	if stmt.Format == nil {
+		return nil
+	}
+
+	for p.peekToken.Type == lexer.COMMA {
+		p.nextToken() // 移动到 ,
+		p.nextToken() // 移动到参数
+		arg := p.parseExpression(LOWEST)
+		if arg == nil {
+			return nil
+		}
+		stmt.Arguments = append(stmt.Arguments, arg)
+	}
+
+	if !p.expectPeek(lexer.RightParen) {
+		return nil
+	}
+
+	if p.peekToken.Type == lexer.SEMICOLON {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// 解析语句块，调用时 curToken 为 {，返回时 curToken 为 }
+// 直到文件末尾都没有遇到 } 时记录错误并返回 nil
+func (p *Parser) parseBlockStatement() *ast.BlockStatement {
+	block := &ast.BlockStatement{Token: p.curToken, Statements: []ast.Statement{}}
+
+	p.nextToken() // 跳过 {
+
+	for p.curToken.Type != lexer.RightBrace {
+		if p.curToken.Type == lexer.EOF {
+			p.expectError(lexer.RightBrace, p.curToken)
+			return nil
+		}
+		stmt := p.parseStatement()
+		if stmt != nil {
+			block.Statements = append(block.Statements, stmt)
+		}
+		p.nextToken()
+	}
+	return block
+}
+
+// 解析表达式语句，结尾的分号可以省略
+func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
+	stmt := &ast.ExpressionStatement{Token: p.curToken}
+
+	stmt.Expression = p.parseExpression(LOWEST)
+
+	if p.peekToken.Type == lexer.SEMICOLON {
+		p.nextToken()
+	}
+	return stmt
+}
+
 // 解析表达式
-func (p *Parser) parseExpression() ast.Expression {
-	left := p.parseIntegerLiteral()
+// 只要下一个运算符的优先级高于 precedence，就把已解析部分作为其左操作数继续解析
+func (p *Parser) parseExpression(precedence int) ast.Expression {
+	prefix := p.prefixParseFns[p.curToken.Type]
+	if prefix == nil {
+		// 与 expectError 相同的 expected X, found Y 形式，文件末尾显示为 end of input
+		p.addError("expected expression, found %s", foundName(p.curToken))
+		return nil
+	}
+	left := prefix()
+
+	for precedence < p.peekPrecedence() {
+		infix := p.infixParseFns[p.peekToken.Type]
+		if infix == nil {
+			return left
+		}
 
-	for p.peekToken.Type == lexer.PLUS || p.peekToken.Type == lexer.MINUS {
 		p.nextToken() // 移动到运算符
-		left = p.parseInfixExpression(left)
+		left = infix(left)
 	}
 	return left
 }
 
+// 解析标识符
+func (p *Parser) parseIdentifier() ast.Expression {
+	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Value}
+}
+
 // 解析整数
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 
 	value, err := strconv.ParseInt(p.curToken.Value, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Value)
-		p.errors = append(p.errors, msg)
+		p.addError("could not parse %q as integer", p.curToken.Value)
 		return nil
 	}
 
@@ -64,6 +515,111 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return lit
 }
 
+// 解析浮点数
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.curToken}
+
+	value, err := strconv.ParseFloat(p.curToken.Value, 64)
+	if err != nil {
+		p.addError("could not parse %q as float", p.curToken.Value)
+		return nil
+	}
+
+	lit.Value = value
+	return lit
+}
+
+// 解析字符
+// 词法分析器按字节读取源码，单字节的值直接作为码点，其余按 UTF-8 解码
+func (p *Parser) parseCharLiteral() ast.Expression {
+	value := p.curToken.Value
+	r, _ := utf8.DecodeRuneInString(value)
+	if len(value) == 1 {
+		r = rune(value[0])
+	}
+	return &ast.CharLiteral{Token: p.curToken, Value: r}
+}
+
+// 解析字符串
+func (p *Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Value}
+}
+
+// 解析布尔值
+func (p *Parser) parseBooleanLiteral() ast.Expression {
+	return &ast.BooleanLiteral{Token: p.curToken, Value: p.curToken.Type == lexer.TRUE}
+}
+
+// 解析前缀表达式
+func (p *Parser) parsePrefixExpression() ast.Expression {
+	expression := &ast.PrefixExpression{
+		Token:    p.curToken,
+		Operator: p.curToken.Value,
+	}
+
+	p.nextToken() // 移动到操作数
+
+	// 乘方比前缀运算符结合得更紧，-2 ** 2 解析为 -(2 ** 2)，而 -x * y 仍是 (-x) * y
+	expression.Right = p.parseExpression(POWER - 1)
+
+	return expression
+}
+
+// 解析括号分组表达式，分组整体作为一个操作数
+// 括号中是类型关键字时解析为类型转换，如 (char)65
+func (p *Parser) parseGroupedExpression() ast.Expression {
+	if p.peekToken.Type == lexer.INT || p.peekToken.Type == lexer.CHAR {
+		return p.parseCastExpression()
+	}
+
+	p.nextToken() // 跳过 (
+
+	exp := p.parseExpression(LOWEST)
+
+	if !p.expectPeek(lexer.RightParen) {
+		return nil
+	}
+
+	return exp
+}
+
+// 解析类型转换表达式：(类型) 操作数，与前缀运算符的优先级相同
+func (p *Parser) parseCastExpression() ast.Expression {
+	exp := &ast.CastExpression{Token: p.curToken}
+
+	p.nextToken() // 移动到类型关键字
+	exp.Type = p.curToken
+
+	if !p.expectPeek(lexer.RightParen) {
+		return nil
+	}
+	p.nextToken() // 移动到操作数
+
+	exp.Right = p.parseExpression(PREFIX)
+	if exp.Right == nil {
+		return nil
+	}
+	return exp
+}
+
+// 解析赋值表达式，左侧只能是标识符
+func (p *Parser) parseAssignExpression(left ast.Expression) ast.Expression {
+	name, ok := left.(*ast.Identifier)
+	if !ok {
+		p.addError("invalid assignment target %s", left)
+		return nil
+	}
+
+	expression := &ast.AssignExpression{Token: p.curToken, Name: name}
+
+	p.nextToken() // 移动到右边的表达式
+
+	// 以稍低的优先级解析右侧，使连续赋值归入右操作数
+	expression.Value = p.parseExpression(ASSIGN - 1)
+
+	return expression
+}
+
 // 解析中缀表达式
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	expression := &ast.InfixExpression{
@@ -72,9 +628,14 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 		Left:     left,
 	}
 
+	precedence := p.curPrecedence()
+	// 右结合运算符以稍低的优先级解析右侧，使同级运算符归入右操作数
+	if p.rightAssoc[p.curToken.Type] {
+		precedence--
+	}
 	p.nextToken() // 移动到右边的表达式
 
-	expression.Right = p.parseIntegerLiteral()
+	expression.Right = p.parseExpression(precedence)
 
 	return expression
 }
@@ -0,0 +1,196 @@
+package test_test
+
+import (
+	"Butterfly/compiler"
+	"Butterfly/lexer"
+	"Butterfly/parser"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// compileSource 将源代码依次经过词法、语法分析和编译，返回字节码
+func compileSource(t *testing.T, input string) *compiler.Bytecode {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("语法分析错误: %v", p.Errors())
+	}
+
+	c := compiler.New()
+	if err := c.Compile(program); err != nil {
+		t.Fatalf("编译失败: %v", err)
+	}
+	return c.Bytecode()
+}
+
+// TestAssembleRoundTrip 验证 Assemble(ins.String()) 能还原原始指令
+func TestAssembleRoundTrip(t *testing.T) {
+	ins := compileSource(t, "100 + 50 - 25 + 25").Instructions
+
+	assembled, err := compiler.Assemble(ins.String())
+	assert.NoError(t, err)
+	assert.Equal(t, ins, assembled)
+}
+
+// TestDisassembleOffsets 验证反汇编的每一行以四位指令偏移开头
+func TestDisassembleOffsets(t *testing.T) {
+	ins := compileSource(t, "1 + 2").Instructions
+	assert.Equal(t, "0000 OpConstant 0\n0003 OpConstant 1\n0006 OpAdd\n0007 OpPop\n", ins.String())
+}
+
+// TestAssembleHandWritten 验证手写的汇编文本被正确编码
+func TestAssembleHandWritten(t *testing.T) {
+	ins, err := compiler.Assemble("OpConstant 0\nOpConstant 1\nOpAdd")
+	assert.NoError(t, err)
+	assert.Equal(t, compiler.Instructions{
+		byte(compiler.OpConstant), 0, 0,
+		byte(compiler.OpConstant), 0, 1,
+		byte(compiler.OpAdd),
+	}, ins)
+}
+
+// TestAssembleErrors 验证非法汇编文本返回错误
+func TestAssembleErrors(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input string
+	}{
+		{"未知操作码", "OpFoo"},
+		{"缺少操作数", "OpConstant"},
+		{"多余操作数", "OpAdd 1"},
+		{"非法操作数", "OpConstant x"},
+		{"只有偏移", "0003"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := compiler.Assemble(tc.input)
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := compiler.Assemble("0000 OpTrue\n0003")
+	assert.EqualError(t, err, "line 2: missing opcode")
+}
+
+// TestDisassembleAllOpcodes 验证每个已定义的操作码都能按定义表反汇编出助记符和操作数
+func TestDisassembleAllOpcodes(t *testing.T) {
+	for op := compiler.Opcode(0); ; op++ {
+		widths, ok := compiler.OperandWidths(op)
+		if !ok {
+			break
+		}
+
+		ins := compiler.Instructions{byte(op)}
+		expected := "0000 " + op.String()
+		for _, w := range widths {
+			for i := 0; i < w; i++ {
+				ins = append(ins, 0)
+			}
+			ins[len(ins)-1] = 7
+			expected += " 7"
+		}
+		assert.Equal(t, expected+"\n", ins.String(), op.String())
+		assert.NotContains(t, ins.String(), "ERROR", op.String())
+	}
+}
+
+// TestDisassembleProgram 验证真实程序的反汇编结果
+func TestDisassembleProgram(t *testing.T) {
+	ins := compileSource(t, `int x = 7; while (x >= 1) { x = x % 2; } printf("%d", -x);`).Instructions
+	expected := "0000 OpConstant 0\n" +
+		"0003 OpSetGlobal 0\n" +
+		"0006 OpGetGlobal 0\n" +
+		"0009 OpConstant 1\n" +
+		"0012 OpGreaterEqual\n" +
+		"0013 OpJumpNotTruthy 33\n" +
+		"0016 OpGetGlobal 0\n" +
+		"0019 OpConstant 2\n" +
+		"0022 OpMod\n" +
+		"0023 OpSetGlobal 0\n" +
+		"0026 OpGetGlobal 0\n" +
+		"0029 OpPop\n" +
+		"0030 OpJump 6\n" +
+		"0033 OpConstant 3\n" +
+		"0036 OpGetGlobal 0\n" +
+		"0039 OpMinus\n" +
+		"0040 OpPrint 2\n"
+	assert.Equal(t, expected, ins.String())
+
+	// 未定义的操作码不会被静默跳过
+	assert.Equal(t, "0000 OpTrue\n0001 ERROR: unknown opcode 255\n0002 OpPop\n", compiler.Instructions{byte(compiler.OpTrue), 0xFF, byte(compiler.OpPop)}.String())
+}
+
+// TestMakeReadOperands 验证按定义宽度编码的操作数可以原样解码
+func TestMakeReadOperands(t *testing.T) {
+	testCases := []struct {
+		op       compiler.Opcode
+		operands []int
+		expected []byte
+	}{
+		{compiler.OpConstant, []int{65534}, []byte{byte(compiler.OpConstant), 0xFF, 0xFE}},
+		{compiler.OpJump, []int{258}, []byte{byte(compiler.OpJump), 1, 2}},
+		{compiler.OpPrint, []int{3}, []byte{byte(compiler.OpPrint), 3}},
+		{compiler.OpAdd, []int{}, []byte{byte(compiler.OpAdd)}},
+	}
+
+	for _, tc := range testCases {
+		ins := compiler.Make(tc.op, tc.operands...)
+		assert.Equal(t, tc.expected, ins, tc.op.String())
+
+		def, err := compiler.Lookup(tc.op)
+		if assert.NoError(t, err) {
+			operands, read, ok := compiler.ReadOperands(def, ins[1:])
+			assert.True(t, ok, tc.op.String())
+			assert.Equal(t, tc.operands, operands, tc.op.String())
+			assert.Equal(t, len(ins)-1, read, tc.op.String())
+		}
+	}
+
+	_, err := compiler.Lookup(compiler.Opcode(255))
+	assert.EqualError(t, err, "opcode 255 undefined")
+
+	// 单字节操作数的取值范围在汇编时同样受到检查
+	_, err = compiler.Assemble("OpPrint 256")
+	assert.EqualError(t, err, `line 1: invalid operand "256"`)
+}
+
+// TestReadOperandsConstant 验证 ReadOperands 解码 OpConstant 的操作数及读取的字节数
+func TestReadOperandsConstant(t *testing.T) {
+	def, err := compiler.Lookup(compiler.OpConstant)
+	assert.NoError(t, err)
+
+	// 操作数之后的字节不会被读取
+	operands, read, ok := compiler.ReadOperands(def, compiler.Instructions{0x01, 0x2C, byte(compiler.OpPop)})
+	assert.True(t, ok)
+	assert.Equal(t, []int{300}, operands)
+	assert.Equal(t, 2, read)
+
+	_, _, ok = compiler.ReadOperands(def, compiler.Instructions{0x01})
+	assert.False(t, ok)
+
+	assert.Equal(t, uint16(300), compiler.ReadUint16(compiler.Instructions{0x01, 0x2C}))
+}
+
+// TestSourceMap 验证源码映射为每条指令给出起始偏移及其源码行列
+func TestSourceMap(t *testing.T) {
+	bytecode := compileSource(t, "int x = 1;\nprintf(\"%d\",\n  x + 2);")
+
+	// 0 OpConstant 0, 3 OpSetGlobal 0, 6 OpConstant 1, 9 OpGetGlobal 0,
+	// 12 OpConstant 2, 15 OpAdd, 16 OpPrint 2
+	expected := []compiler.SourceMapEntry{
+		{Offset: 0, Line: 1, Column: 9},
+		{Offset: 3, Line: 1, Column: 1},
+		{Offset: 6, Line: 2, Column: 8},
+		{Offset: 9, Line: 3, Column: 3},
+		{Offset: 12, Line: 3, Column: 7},
+		{Offset: 15, Line: 3, Column: 5},
+		{Offset: 16, Line: 2, Column: 1},
+	}
+	assert.Equal(t, expected, bytecode.SourceMap())
+
+	// 汇编得到的字节码没有位置信息
+	ins, err := compiler.Assemble("OpTrue\nOpPop")
+	assert.NoError(t, err)
+	assert.Empty(t, (&compiler.Bytecode{Instructions: ins}).SourceMap())
+}
@@ -0,0 +1,279 @@
+package test_test
+
+import (
+	"Butterfly/ast"
+	"Butterfly/compiler"
+	"Butterfly/lexer"
+	"Butterfly/parser"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// TestConstantDeduplication 验证相同的常量在常量池中只保存一份
+func TestConstantDeduplication(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected []interface{}
+	}{
+		{"2 + 2", []interface{}{int64(2)}},
+		{"2 + 2 + 2", []interface{}{int64(2)}},
+		{"1 + 2 - 1 * 2", []interface{}{int64(1), int64(2)}},
+		{"2 + 2.0", []interface{}{int64(2), 2.0}}, // 类型不同的常量不合并
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, compileSource(t, tc.input).Constants, tc.input)
+	}
+}
+
+// TestStringInterning 验证相同的字符串字面量共用一个常量池槽位
+func TestStringInterning(t *testing.T) {
+	bytecode := compileSource(t, `printf("%d", 1); printf("%d", 2); "ab" + "ab"`)
+	assert.Equal(t, []interface{}{"%d", int64(1), int64(2), "ab"}, bytecode.Constants)
+
+	expected := "0000 OpConstant 0\n0003 OpConstant 1\n0006 OpPrint 2\n" +
+		"0008 OpConstant 0\n0011 OpConstant 2\n0014 OpPrint 2\n" +
+		"0016 OpConstant 3\n0019 OpConstant 3\n0022 OpAdd\n0023 OpPop\n"
+	assert.Equal(t, expected, bytecode.Instructions.String())
+}
+
+// TestBooleanConstants 验证布尔字面量使用 OpTrue/OpFalse 而不占用常量池
+func TestBooleanConstants(t *testing.T) {
+	bytecode := compileSource(t, "true == !false; false != true")
+	assert.Empty(t, bytecode.Constants)
+	assert.Equal(t, "0000 OpTrue\n0001 OpFalse\n0002 OpBang\n0003 OpEqual\n0004 OpPop\n0005 OpFalse\n0006 OpTrue\n0007 OpNotEqual\n0008 OpPop\n", bytecode.Instructions.String())
+}
+
+// TestExpressionStatementPop 验证表达式语句之后生成 OpPop
+func TestExpressionStatementPop(t *testing.T) {
+	ins := compileSource(t, "1 + 2").Instructions
+	assert.Equal(t, "0000 OpConstant 0\n0003 OpConstant 1\n0006 OpAdd\n0007 OpPop\n", ins.String())
+}
+
+// TestInstructionPositions 验证每条指令都记录了来源的源码位置
+func TestInstructionPositions(t *testing.T) {
+	bytecode := compileSource(t, "1;\n  2 * 3;")
+
+	// 指令偏移：0 OpConstant 1, 3 OpPop, 4 OpConstant 2, 7 OpConstant 3, 10 OpMul, 11 OpPop
+	expected := map[int]compiler.Position{
+		0:  {Line: 1, Column: 1},
+		3:  {Line: 1, Column: 1},
+		4:  {Line: 2, Column: 3},
+		7:  {Line: 2, Column: 7},
+		10: {Line: 2, Column: 5},
+		11: {Line: 2, Column: 3},
+	}
+	for offset, pos := range expected {
+		actual, ok := bytecode.PositionAt(offset)
+		assert.True(t, ok, "offset %d", offset)
+		assert.Equal(t, pos, actual, "offset %d", offset)
+	}
+	assert.Len(t, bytecode.Positions, len(bytecode.Instructions))
+}
+
+// compileError 编译源代码并返回编译错误
+func compileError(t *testing.T, input string) error {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("语法分析错误: %v", p.Errors())
+	}
+	return compiler.New().Compile(program)
+}
+
+// TestUnknownInfixOperator 验证没有对应操作码的中缀运算符是编译错误，而不是只编译操作数
+func TestUnknownInfixOperator(t *testing.T) {
+	program := &ast.Program{Statements: []ast.Statement{
+		&ast.ExpressionStatement{Expression: &ast.InfixExpression{
+			Operator: "<<",
+			Left:     &ast.IntegerLiteral{Value: 1},
+			Right:    &ast.IntegerLiteral{Value: 2},
+		}},
+	}}
+	assert.EqualError(t, compiler.New().Compile(program), "unknown operator <<")
+}
+
+// TestOperandOverflow 验证程序过大、跳转目标超过2字节时报告编译错误而不是截断
+func TestOperandOverflow(t *testing.T) {
+	// 每条 1; 生成 OpConstant 和 OpPop 共4字节
+	input := "if (true) { " + strings.Repeat("1;", 16400) + " }"
+	assert.EqualError(t, compileError(t, input), "operand 65604 does not fit in 2-byte operand of OpJumpNotTruthy")
+}
+
+// TestCompileGlobalVariables 验证变量声明和引用生成的全局变量指令
+func TestCompileGlobalVariables(t *testing.T) {
+	ins := compileSource(t, "int x = 5; int y = x;").Instructions
+	assert.Equal(t, "0000 OpConstant 0\n0003 OpSetGlobal 0\n0006 OpGetGlobal 0\n0009 OpSetGlobal 1\n", ins.String())
+
+	assert.EqualError(t, compileError(t, "x + 1"), "undefined variable x")
+	assert.EqualError(t, compileError(t, "int x = 2; x * (y + 1)"), "undefined variable y")
+	assert.EqualError(t, compileError(t, "int x = x;"), "undefined variable x")
+	assert.EqualError(t, compileError(t, "int x = 1; char x = 'a';"), "variable x already declared")
+	assert.EqualError(t, compileError(t, "y = 1;"), "undefined variable y")
+}
+
+// TestBreakContinueOutsideLoop 验证循环外的 break 和 continue 是编译错误
+func TestBreakContinueOutsideLoop(t *testing.T) {
+	assert.EqualError(t, compileError(t, "break;"), "break outside loop")
+	assert.EqualError(t, compileError(t, "if (true) { continue; }"), "continue outside loop")
+	assert.EqualError(t, compileError(t, "while (false) {} break"), "break outside loop")
+}
+
+// TestSymbolTable 验证符号按声明顺序分配全局槽位
+func TestSymbolTable(t *testing.T) {
+	table := compiler.NewSymbolTable()
+	assert.Equal(t, compiler.Symbol{Name: "a", Scope: compiler.GlobalScope, Index: 0}, table.Define("a"))
+	assert.Equal(t, compiler.Symbol{Name: "b", Scope: compiler.GlobalScope, Index: 1}, table.Define("b"))
+
+	symbol, ok := table.Resolve("b")
+	assert.True(t, ok)
+	assert.Equal(t, 1, symbol.Index)
+
+	_, ok = table.Resolve("c")
+	assert.False(t, ok)
+
+	// 块作用域中的符号离开作用域后不可见，被遮蔽的外层符号恢复
+	table.EnterScope()
+	assert.False(t, table.DefinedInScope("a"))
+	assert.Equal(t, compiler.Symbol{Name: "a", Scope: compiler.GlobalScope, Index: 2}, table.Define("a"))
+	table.Define("c")
+	assert.True(t, table.DefinedInScope("c"))
+	table.LeaveScope()
+
+	symbol, _ = table.Resolve("a")
+	assert.Equal(t, 0, symbol.Index)
+	_, ok = table.Resolve("c")
+	assert.False(t, ok)
+	assert.Len(t, table.Symbols(), 4)
+}
+
+// TestForScope 验证 for 循环的变量在循环结束后不可见
+func TestForScope(t *testing.T) {
+	assert.EqualError(t, compileError(t, "for (int i = 0; i < 3; i = i + 1) {} i;"), "undefined variable i")
+	assert.EqualError(t, compileError(t, "for (int i = 0; i < 3; i = i + 1) { int i; }"), "variable i already declared")
+}
+
+// TestIfJumps 验证条件语句的跳转目标被正确回填
+func TestIfJumps(t *testing.T) {
+	ins := compileSource(t, "if (true) { 10 } else { 20 }; 30").Instructions
+	expected := "0000 OpTrue\n" +
+		"0001 OpJumpNotTruthy 11\n" +
+		"0004 OpConstant 0\n" +
+		"0007 OpPop\n" +
+		"0008 OpJump 15\n" +
+		"0011 OpConstant 1\n" +
+		"0014 OpPop\n" +
+		"0015 OpConstant 2\n" +
+		"0018 OpPop\n"
+	assert.Equal(t, expected, ins.String())
+
+	ins = compileSource(t, "if (true) { 10 }").Instructions
+	assert.Equal(t, "0000 OpTrue\n0001 OpJumpNotTruthy 8\n0004 OpConstant 0\n0007 OpPop\n", ins.String())
+}
+
+// TestWhileJumps 验证循环末尾跳回条件处，条件为假时跳到循环之后
+func TestWhileJumps(t *testing.T) {
+	ins := compileSource(t, "while (true) { 1 }").Instructions
+	expected := "0000 OpTrue\n" +
+		"0001 OpJumpNotTruthy 11\n" +
+		"0004 OpConstant 0\n" +
+		"0007 OpPop\n" +
+		"0008 OpJump 0\n"
+	assert.Equal(t, expected, ins.String())
+}
+
+// compileWarnings 编译源代码并返回编译器产生的警告
+func compileWarnings(t *testing.T, input string) []string {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("语法分析错误: %v", p.Errors())
+	}
+
+	c := compiler.New()
+	if err := c.Compile(program); err != nil {
+		t.Fatalf("编译失败: %v", err)
+	}
+	return c.Warnings()
+}
+
+// TestCharRangeWarning 验证超出 char 范围的整数字面量产生警告
+func TestCharRangeWarning(t *testing.T) {
+	assert.Equal(t, []string{"integer 300 out of range for char"}, compileWarnings(t, "char c = 300;"))
+	assert.Empty(t, compileWarnings(t, "char c = 65;"))
+	assert.Empty(t, compileWarnings(t, "char c = 255;"))
+	assert.Empty(t, compileWarnings(t, "int x = 300;"))
+	assert.Equal(t, []string{"integer 300 out of range for char"}, compileWarnings(t, "(char)300;"))
+	assert.Empty(t, compileWarnings(t, "(int)300;"))
+}
+
+// TestSelfAssignmentWarning 验证把变量赋值给自身时产生警告
+func TestSelfAssignmentWarning(t *testing.T) {
+	assert.Equal(t, []string{"self-assignment has no effect"}, compileWarnings(t, "int x=1; x = x;"))
+	assert.Empty(t, compileWarnings(t, "int x=1; x = x + 0;"))
+	assert.Empty(t, compileWarnings(t, "int x=1; int y=2; x = y;"))
+}
+
+// TestStrictConditions 验证严格条件模式拒绝非布尔的条件表达式
+func TestStrictConditions(t *testing.T) {
+	compileStrict := func(input string) error {
+		p := parser.New(lexer.New(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("语法分析错误: %v", p.Errors())
+		}
+		c := compiler.New()
+		c.EnableStrictConditions()
+		return c.Compile(program)
+	}
+
+	assert.EqualError(t, compileStrict("if (5) {}"), "condition 5 is not boolean; compare explicitly, e.g. 5 != 0")
+	assert.EqualError(t, compileStrict("int x = 1; while (x - 1) {}"), "condition (x - 1) is not boolean; compare explicitly, e.g. (x - 1) != 0")
+	assert.EqualError(t, compileStrict("for (int i = 0; i; i = i + 1) {}"), "condition i is not boolean; compare explicitly, e.g. i != 0")
+
+	for _, input := range []string{"if (5 != 0) {}", "if (!1) {}", "while (false) {}", "int i; for (; i < 3;) {}", "for (;;) { break; }"} {
+		assert.NoError(t, compileStrict(input), input)
+	}
+
+	// 默认模式仍然允许整数作为条件
+	assert.NoError(t, compileError(t, "if (5) {}"))
+}
+
+// TestUninitializedReadWarning 验证读取声明后尚未赋值的变量时产生警告
+func TestUninitializedReadWarning(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected []string
+	}{
+		{"int x; int y = x;", []string{"variable x is used before being assigned"}},
+		{"int x; x + x;", []string{"variable x is used before being assigned"}}, // 每个变量只警告一次
+		{"int x; x = x + 1;", []string{"variable x is used before being assigned"}},
+		{"int x; if (true) { x = 1; } x;", []string{"variable x is used before being assigned"}},
+		{"int x; while (false) { x = 1; } x;", []string{"variable x is used before being assigned"}},
+		{"int x; for (;false;) { x = 1; } x;", []string{"variable x is used before being assigned"}},
+		{"int x; x = 1; int y = x;", nil},
+		{"int x = 0; int y = x;", nil},
+		{"int x; if (true) { x = 1; } else { x = 2; } x;", nil},
+		{"int x; if ((x = 1) > 0) {} x;", nil},
+		{"int x;", nil},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, nilIfEmpty(compileWarnings(t, tc.input)), tc.input)
+	}
+
+	// 警告记录读取处的源码位置
+	p := parser.New(lexer.New("int x;\nint y = x;"))
+	c := compiler.New()
+	assert.NoError(t, c.Compile(p.ParseProgram()))
+	assert.Equal(t, []compiler.Warning{{Pos: compiler.Position{Line: 2, Column: 9}, Message: "variable x is used before being assigned"}}, c.WarningDetails())
+}
+
+// nilIfEmpty 将空切片统一为 nil，便于与期望值比较
+func nilIfEmpty(s []string) []string {
+	if len(s) == 0 {
+		return nil
+	}
+	return s
+}
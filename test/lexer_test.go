@@ -4,6 +4,7 @@ package test_test
 // 导入所需包
 import (
 	"Butterfly/lexer"                    // 自定义词法分析器包
+	"fmt"                                // 格式化输出包
 	"github.com/stretchr/testify/assert" // 断言库用于测试验证
 	"os"                                 // 操作系统功能包
 	"path/filepath"                      // 文件路径处理包
@@ -156,3 +157,219 @@ func normalize(lines []string) []string {
 	// 返回规范化后的行切片
 	return normalized
 }
+
+// lexCodes 对输入进行词法分析，返回除 EOF 之外所有词法单元的类型代码
+func lexCodes(input string) []string {
+	l := lexer.New(input)
+	var codes []string
+	for {
+		token := l.NextToken()
+		if token.Type == lexer.EOF {
+			break
+		}
+		codes = append(codes, token.Type.Code())
+	}
+	return codes
+}
+
+// TestLexerArrow 验证 "->" 被识别为单个 ARROW 词法单元
+func TestLexerArrow(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected []string
+	}{
+		{"a->b", []string{"IDENFR", "ARROW", "IDENFR"}},
+		{"a - > b", []string{"IDENFR", "MINU", "GRE", "IDENFR"}},
+		{"a-b", []string{"IDENFR", "MINU", "IDENFR"}},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, lexCodes(tc.input), tc.input)
+	}
+}
+
+// TestCountTokens 验证按类型统计词法单元的数量
+func TestCountTokens(t *testing.T) {
+	counts := lexer.CountTokens("int a = 1; int b = a + 2;")
+
+	assert.Equal(t, map[lexer.TokenType]int{
+		lexer.INT:        2,
+		lexer.IDENTIFIER: 3,
+		lexer.ASSIGN:     2,
+		lexer.NUMBER:     2,
+		lexer.SEMICOLON:  2,
+		lexer.PLUS:       1,
+	}, counts)
+}
+
+// TestLexerOctalEscapes 验证 \0 及八进制转义在字符串和字符字面量中产生对应字节
+func TestLexerOctalEscapes(t *testing.T) {
+	token := lexer.New(`"a\0b"`).NextToken()
+	assert.Equal(t, lexer.STRING, token.Type)
+	assert.Equal(t, 3, len(token.Value))
+	assert.Contains(t, token.Value, "\x00")
+
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{`"\101\102"`, "AB"},
+		{`"\1010"`, "A0"},
+		{`"\12x"`, "\nx"},
+		{`'\0'`, "\x00"},
+		{`'\101'`, "A"},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, lexer.New(tc.input).NextToken().Value, tc.input)
+	}
+
+	assert.Panics(t, func() { lexer.New(`"\777"`).NextToken() })
+}
+
+// TestLexerModulo 验证 % 被识别为 MODULO 词法单元
+func TestLexerModulo(t *testing.T) {
+	assert.Equal(t, []string{"INTCON", "MOD", "INTCON"}, lexCodes("10 % 3"))
+}
+
+// TestLexerComments 验证单行注释和块注释被跳过，且不影响后续词法单元的位置
+func TestLexerComments(t *testing.T) {
+	input := "int a; // 行注释 int b;\n" +
+		"/* 块注释\nlines * / */ a = 1 /**/ + 2; /* a */ // 结尾\n" +
+		"a / 2"
+
+	// 块注释之后的词法单元位于第 3 行，列号从注释结束处继续计算
+	expected := []lexer.Token{
+		{Type: lexer.INT, Value: "int", Line: 1, Column: 1},
+		{Type: lexer.IDENTIFIER, Value: "a", Line: 1, Column: 5},
+		{Type: lexer.SEMICOLON, Value: ";", Line: 1, Column: 6},
+		{Type: lexer.IDENTIFIER, Value: "a", Line: 3, Column: 14},
+		{Type: lexer.ASSIGN, Value: "=", Line: 3, Column: 16},
+		{Type: lexer.NUMBER, Value: "1", Line: 3, Column: 18},
+		{Type: lexer.PLUS, Value: "+", Line: 3, Column: 25},
+		{Type: lexer.NUMBER, Value: "2", Line: 3, Column: 27},
+		{Type: lexer.SEMICOLON, Value: ";", Line: 3, Column: 28},
+		{Type: lexer.IDENTIFIER, Value: "a", Line: 4, Column: 1},
+		{Type: lexer.DIVIDE, Value: "/", Line: 4, Column: 3},
+		{Type: lexer.NUMBER, Value: "2", Line: 4, Column: 5},
+		{Type: lexer.EOF, Value: "", Line: 4, Column: 6},
+	}
+	if diff := DiffTokens(expected, lexTokens(lexer.New(input))); diff != "" {
+		t.Error(diff)
+	}
+}
+
+// TestLexerUnclosedBlockComment 验证未闭合的块注释引发错误而不是死循环
+func TestLexerUnclosedBlockComment(t *testing.T) {
+	assert.Panics(t, func() { lexCodes("1 /* 未闭合 *") })
+}
+
+// TestLexerRecovery 验证开启错误恢复后，词法错误被记录并跳过，后续词法单元照常返回
+func TestLexerRecovery(t *testing.T) {
+	l := lexer.New("1 @ 2\n0x + $")
+	l.EnableRecovery()
+
+	expected := []lexer.Token{
+		{Type: lexer.NUMBER, Value: "1", Line: 1, Column: 1},
+		{Type: lexer.NUMBER, Value: "2", Line: 1, Column: 5},
+		{Type: lexer.PLUS, Value: "+", Line: 2, Column: 4},
+		{Type: lexer.EOF, Value: "", Line: 2, Column: 7},
+	}
+	if diff := DiffTokens(expected, lexTokens(l)); diff != "" {
+		t.Error(diff)
+	}
+	assert.Equal(t, []*lexer.Error{
+		{Line: 1, Column: 3, Message: "Unexpected character: @ at 1:3"},
+		{Line: 2, Column: 1, Message: "无效数字: 0x 在行 2:1"},
+		{Line: 2, Column: 6, Message: "Unexpected character: $ at 2:6"},
+	}, l.Errors())
+
+	// 未开启错误恢复时以 *lexer.Error 引发恐慌
+	assert.PanicsWithError(t, "Unexpected character: @ at 1:1", func() { lexer.New("@").NextToken() })
+}
+
+// TestLexerNumberBases 验证十六进制和二进制字面量（含前缀）作为一个整型词法单元
+func TestLexerNumberBases(t *testing.T) {
+	assert.Equal(t, []string{"0xFF", "+", "0b1", "-", "010"}, lexValues("0xFF + 0b1 - 010"))
+	assert.Equal(t, []string{"INTCON", "PLUS", "INTCON"}, lexCodes("0X1f+0B10"))
+	assert.Panics(t, func() { lexCodes("0x") })
+	assert.Panics(t, func() { lexCodes("0b2") })
+}
+
+// TestLexerFloat 验证浮点数字面量被识别为单个 FLOAT 词法单元
+func TestLexerFloat(t *testing.T) {
+	assert.Equal(t, []string{"3.14"}, lexValues("3.14"))
+	assert.Equal(t, []string{"FLOATCON", "PLUS", "INTCON"}, lexCodes("1.0 + 2"))
+	assert.Panics(t, func() { lexCodes("1.2.3") })
+}
+
+// TestTokenDisplayName 验证词法单元类型面向用户的显示名称
+func TestTokenDisplayName(t *testing.T) {
+	testCases := []struct {
+		tokenType lexer.TokenType
+		expected  string
+	}{
+		{lexer.SEMICOLON, "';'"},
+		{lexer.LeftParen, "'('"},
+		{lexer.LessEqual, "'<='"},
+		{lexer.IF, "'if'"},
+		{lexer.IDENTIFIER, "identifier"},
+		{lexer.NUMBER, "integer literal"},
+		{lexer.STRING, "string literal"},
+		{lexer.EOF, "end of input"},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, tc.tokenType.DisplayName(), tc.tokenType.Code())
+	}
+}
+
+// DiffTokens 比较两个词法单元序列，返回第一个不一致位置的可读描述
+// 两个序列完全相同时返回空字符串；某一方较短时缺少的一侧显示为 <missing>
+func DiffTokens(expected, actual []lexer.Token) string {
+	describe := func(tokens []lexer.Token, i int) string {
+		if i >= len(tokens) {
+			return "<missing>"
+		}
+		tok := tokens[i]
+		return fmt.Sprintf("%s (%d:%d)", tok.String(), tok.Line, tok.Column)
+	}
+
+	n := max(len(expected), len(actual))
+	for i := 0; i < n; i++ {
+		if i < len(expected) && i < len(actual) && expected[i] == actual[i] {
+			continue
+		}
+		return fmt.Sprintf("token %d differs:\n  expected: %s\n  actual:   %s", i, describe(expected, i), describe(actual, i))
+	}
+	return ""
+}
+
+// lexTokens 读取词法分析器的全部词法单元，包括末尾的 EOF
+func lexTokens(l *lexer.Lexer) []lexer.Token {
+	var tokens []lexer.Token
+	for {
+		tok := l.NextToken()
+		tokens = append(tokens, tok)
+		if tok.Type == lexer.EOF {
+			return tokens
+		}
+	}
+}
+
+// TestDiffTokens 验证 DiffTokens 报告第一个不一致的词法单元
+func TestDiffTokens(t *testing.T) {
+	lex := func(input string) []lexer.Token {
+		return lexTokens(lexer.New(input))
+	}
+
+	assert.Equal(t, "", DiffTokens(lex("int x = 1;"), lex("int x = 1;")))
+
+	expected := "token 3 differs:\n  expected: INTCON   1 (1:9)\n  actual:   INTCON   2 (1:9)"
+	assert.Equal(t, expected, DiffTokens(lex("int x = 1;"), lex("int x = 2;")))
+
+	expected = "token 3 differs:\n  expected: EOF       (1:6)\n  actual:   PLUS     + (1:7)"
+	assert.Equal(t, expected, DiffTokens(lex("x + y"), lex("x + y + z")))
+
+	expected = "token 3 differs:\n  expected: <missing>\n  actual:   EOF       (1:6)"
+	assert.Equal(t, expected, DiffTokens(lex("x + y")[:3], lex("x + y")))
+}
@@ -0,0 +1,550 @@
+package test_test
+
+import (
+	"Butterfly/ast"
+	"Butterfly/lexer"
+	"Butterfly/parser"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// parseSource 解析输入并断言没有语法错误，返回 AST 的字符串形式
+func parseSource(t *testing.T, p *parser.Parser) string {
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("语法分析错误: %v", p.Errors())
+	}
+	return program.String()
+}
+
+// TestParseAdditive 验证加减法按左结合解析
+func TestParseAdditive(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"1", "1"},
+		{"1 + 2", "(1 + 2)"},
+		{"1 - 2 - 3", "((1 - 2) - 3)"},
+		{"100 + 50 - 25 + 25", "(((100 + 50) - 25) + 25)"},
+	}
+
+	for _, tc := range testCases {
+		p := parser.New(lexer.New(tc.input))
+		assert.Equal(t, tc.expected, parseSource(t, p), tc.input)
+	}
+}
+
+// TestParseMultiplicative 验证乘除法的优先级高于加减法
+func TestParseMultiplicative(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"2 * 3", "(2 * 3)"},
+		{"2 * 3 + 4", "((2 * 3) + 4)"},
+		{"2 + 3 * 4", "(2 + (3 * 4))"},
+		{"8 / 4 / 2", "((8 / 4) / 2)"},
+		{"1 + 6 / 3 - 2 * 2", "((1 + (6 / 3)) - (2 * 2))"},
+		{"2 * 3 ** 2", "(2 * (3 ** 2))"},
+		{"1 + 10 % 3", "(1 + (10 % 3))"},
+		{"10 % 4 * 2", "((10 % 4) * 2)"},
+	}
+
+	for _, tc := range testCases {
+		p := parser.New(lexer.New(tc.input))
+		assert.Equal(t, tc.expected, parseSource(t, p), tc.input)
+	}
+}
+
+// TestParseGrouped 验证括号分组覆盖默认优先级
+func TestParseGrouped(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"(1 + 2) * 3", "((1 + 2) * 3)"},
+		{"((1+2))", "(1 + 2)"},
+		{"2 * (3 + (4 - 1))", "(2 * (3 + (4 - 1)))"},
+		{"(2 ** 3) ** 2", "((2 ** 3) ** 2)"},
+		{"(((7)))", "7"},
+	}
+
+	for _, tc := range testCases {
+		p := parser.New(lexer.New(tc.input))
+		assert.Equal(t, tc.expected, parseSource(t, p), tc.input)
+	}
+}
+
+// TestParseCastExpression 验证括号中是类型关键字时解析为类型转换而不是分组
+func TestParseCastExpression(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"(char)65", "((char)65)"},
+		{"(int)'A'", "((int)'A')"},
+		{"(int)x + 1", "(((int)x) + 1)"},
+		{"(char)(x + 1)", "((char)(x + 1))"},
+		{"(int)-1", "((int)(-1))"},
+		{"(int)(char)65", "((int)((char)65))"},
+		{"(x) + 1", "(x + 1)"},
+	}
+
+	for _, tc := range testCases {
+		p := parser.New(lexer.New(tc.input))
+		assert.Equal(t, tc.expected, parseSource(t, p), tc.input)
+	}
+
+	p := parser.New(lexer.New("(int 65"))
+	p.ParseProgram()
+	assert.Equal(t, []string{"parse error at 1:6: expected ')', found '65'"}, p.Errors())
+}
+
+// TestParseUnclosedParen 验证缺少右括号时报告错误
+func TestParseUnclosedParen(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"(1 + 2", "parse error at 1:7: expected ')', found end of input"},
+		{"(1 + 2;", "parse error at 1:7: expected ')', found ';'"},
+		{"3 * ((1 + 2) 4", "parse error at 1:14: expected ')', found '4'"},
+		{"(1 2)", "parse error at 1:4: expected ')', found '2'"},
+		{"(3 ** 2 }", "parse error at 1:9: expected ')', found '}'"},
+	}
+
+	for _, tc := range testCases {
+		p := parser.New(lexer.New(tc.input))
+		p.ParseProgram()
+		assert.Contains(t, p.Errors(), tc.expected, tc.input)
+	}
+}
+
+// TestRegisterInfix 验证新注册的运算符按给定优先级参与解析，且为左结合
+func TestRegisterInfix(t *testing.T) {
+	testCases := []struct {
+		name       string
+		precedence int
+		input      string
+		expected   string
+	}{
+		{"高于加法", parser.PRODUCT, "1 + 2 * 3", "(1 + (2 * 3))"},
+		{"高于加法-左侧", parser.PRODUCT, "1 * 2 + 3", "((1 * 2) + 3)"},
+		{"左结合", parser.PRODUCT, "2 * 3 * 4", "((2 * 3) * 4)"},
+		{"与加法同级", parser.SUM, "1 + 2 * 3", "((1 + 2) * 3)"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := parser.New(lexer.New(tc.input))
+			p.RegisterInfix(lexer.MULTIPLY, tc.precedence)
+			assert.Equal(t, tc.expected, parseSource(t, p))
+		})
+	}
+}
+
+// TestParseIntegerError 验证无法解析的词法单元产生语法错误
+func TestParseIntegerError(t *testing.T) {
+	p := parser.New(lexer.New("1 + )"))
+	p.ParseProgram()
+	assert.NotEmpty(t, p.Errors())
+}
+
+// TestParseAssociativity 验证 ** 为右结合而 - 保持左结合
+func TestParseAssociativity(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"2 ** 3 ** 2", "(2 ** (3 ** 2))"},
+		{"1 - 2 - 3", "((1 - 2) - 3)"},
+		{"1 + 2 ** 3", "(1 + (2 ** 3))"},
+		{"2 ** 3 + 1", "((2 ** 3) + 1)"},
+	}
+
+	for _, tc := range testCases {
+		p := parser.New(lexer.New(tc.input))
+		assert.Equal(t, tc.expected, parseSource(t, p), tc.input)
+	}
+}
+
+// TestRegisterRightInfix 验证注册为右结合的运算符按右结合解析
+func TestRegisterRightInfix(t *testing.T) {
+	p := parser.New(lexer.New("1 - 2 - 3"))
+	p.RegisterRightInfix(lexer.MINUS, parser.SUM)
+	assert.Equal(t, "(1 - (2 - 3))", parseSource(t, p))
+}
+
+// TestParseComparison 验证比较运算符的优先级低于算术运算符
+func TestParseComparison(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"1 < 2", "(1 < 2)"},
+		{"1 + 2 * 3 == 7", "((1 + (2 * 3)) == 7)"},
+		{"1 < 2 == 3 > 4", "((1 < 2) == (3 > 4))"},
+		{"5 >= 4 != 3 <= 2", "((5 >= 4) != (3 <= 2))"},
+	}
+
+	for _, tc := range testCases {
+		p := parser.New(lexer.New(tc.input))
+		assert.Equal(t, tc.expected, parseSource(t, p), tc.input)
+	}
+}
+
+// TestParseBooleanAndBang 验证布尔字面量以及 ! 和 - 前缀表达式的解析
+func TestParseBooleanAndBang(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"true", "true"},
+		{"!false", "(!false)"},
+		{"!!true", "(!(!true))"},
+		{"!1 == 2", "((!1) == 2)"},
+		{"!(1 == 2)", "(!(1 == 2))"},
+		{"-5", "(-5)"},
+		{"-(1+2)", "(-(1 + 2))"},
+		{"--5", "(-(-5))"},
+		{"3 - -2", "(3 - (-2))"},
+		{"-2 * 3", "((-2) * 3)"},
+		{"-2 ** 2", "(-(2 ** 2))"},
+		{"(-2) ** 2", "((-2) ** 2)"},
+		{"2 ** -1", "(2 ** (-1))"},
+	}
+
+	for _, tc := range testCases {
+		p := parser.New(lexer.New(tc.input))
+		assert.Equal(t, tc.expected, parseSource(t, p), tc.input)
+	}
+}
+
+// TestParseStatements 验证以分号分隔的多条表达式语句
+func TestParseStatements(t *testing.T) {
+	p := parser.New(lexer.New("1+2; 3-1;"))
+	program := p.ParseProgram()
+	assert.Empty(t, p.Errors())
+
+	if assert.Len(t, program.Statements, 2) {
+		assert.Equal(t, "(1 + 2)", program.Statements[0].String())
+		assert.Equal(t, "(3 - 1)", program.Statements[1].String())
+	}
+}
+
+// TestParseEmptyStatements 验证单独的分号作为空语句被忽略
+func TestParseEmptyStatements(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected int
+	}{
+		{";", 0},
+		{"1+2;;;", 1},
+		{";;1;;2", 2},
+		{"", 0},
+	}
+
+	for _, tc := range testCases {
+		p := parser.New(lexer.New(tc.input))
+		program := p.ParseProgram()
+		assert.Empty(t, p.Errors(), tc.input)
+		assert.Len(t, program.Statements, tc.expected, tc.input)
+	}
+}
+
+// TestParseLetStatement 验证变量声明语句的解析
+func TestParseLetStatement(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"int x = 5;", "int x = 5;"},
+		{"char c = 'a'", "char c = 'a';"},
+		{"int y = 1 + 2 * 3;", "int y = (1 + (2 * 3));"},
+		{"int z;", "int z;"},
+		{"int x = 1; x + 2;", "int x = 1;(x + 2)"},
+	}
+
+	for _, tc := range testCases {
+		p := parser.New(lexer.New(tc.input))
+		assert.Equal(t, tc.expected, parseSource(t, p), tc.input)
+	}
+
+	p := parser.New(lexer.New("int = 5;"))
+	p.ParseProgram()
+	assert.Contains(t, p.Errors(), "parse error at 1:5: expected identifier, found '='")
+}
+
+// TestParseIdentifier 验证标识符可以作为表达式的操作数
+func TestParseIdentifier(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"x", "x"},
+		{"x + 3", "(x + 3)"},
+		{"-x * y", "((-x) * y)"},
+		{"a + b * c", "(a + (b * c))"},
+		{"(count - 1) / total", "((count - 1) / total)"},
+	}
+
+	for _, tc := range testCases {
+		p := parser.New(lexer.New(tc.input))
+		assert.Equal(t, tc.expected, parseSource(t, p), tc.input)
+	}
+}
+
+// TestParseAssignExpression 验证赋值表达式为右结合且优先级最低
+func TestParseAssignExpression(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 5", "(x = 5)"},
+		{"x = x + 1", "(x = (x + 1))"},
+		{"x = y = 3", "(x = (y = 3))"},
+		{"x = a == b", "(x = (a == b))"},
+	}
+
+	for _, tc := range testCases {
+		p := parser.New(lexer.New(tc.input))
+		assert.Equal(t, tc.expected, parseSource(t, p), tc.input)
+	}
+
+	p := parser.New(lexer.New("x + 1 = 2"))
+	p.ParseProgram()
+	assert.Contains(t, p.Errors(), "parse error at 1:7: invalid assignment target (x + 1)")
+}
+
+// TestParseIfStatement 验证条件语句及其 else、else if 分支的解析
+func TestParseIfStatement(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"if (x < y) { x }", "if (x < y) {x}"},
+		{"if (x) { 1; 2; } else { 3 }", "if x {12} else {3}"},
+		{"if (a) { 1 } else if (b) { 2 } else { 3 }", "if a {1} else {if b {2} else {3}}"},
+		{"if (a) {}", "if a {}"},
+	}
+
+	for _, tc := range testCases {
+		p := parser.New(lexer.New(tc.input))
+		assert.Equal(t, tc.expected, parseSource(t, p), tc.input)
+	}
+
+	errorCases := []struct {
+		input    string
+		expected string
+	}{
+		{"if x { 1 }", "parse error at 1:4: expected '(', found 'x'"},
+		{"if (x { 1 }", "parse error at 1:7: expected ')', found '{'"},
+		{"if (x) 1", "parse error at 1:8: expected '{', found '1'"},
+		{"if (x) { 1", "parse error at 1:11: expected '}', found end of input"},
+		{"if (x) { 1 } else 2", "parse error at 1:19: expected '{', found '2'"},
+	}
+
+	for _, tc := range errorCases {
+		p := parser.New(lexer.New(tc.input))
+		p.ParseProgram()
+		assert.Contains(t, p.Errors(), tc.expected, tc.input)
+	}
+}
+
+// TestParseWhileStatement 验证循环语句的解析
+func TestParseWhileStatement(t *testing.T) {
+	p := parser.New(lexer.New("while (i < 10) { i = i + 1; }"))
+	assert.Equal(t, "while (i < 10) {(i = (i + 1))}", parseSource(t, p))
+
+	p = parser.New(lexer.New("while (true) { 1"))
+	p.ParseProgram()
+	assert.Contains(t, p.Errors(), "parse error at 1:17: expected '}', found end of input")
+}
+
+// TestParseBlockStatement 验证独立语句块及嵌套语句块的解析
+func TestParseBlockStatement(t *testing.T) {
+	p := parser.New(lexer.New("{ 1; 2; }"))
+	program := p.ParseProgram()
+	assert.Empty(t, p.Errors())
+
+	if assert.Len(t, program.Statements, 1) {
+		block, ok := program.Statements[0].(*ast.BlockStatement)
+		if assert.True(t, ok) {
+			assert.Len(t, block.Statements, 2)
+		}
+	}
+
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"{}", "{}"},
+		{"{ 1; { 2; { 3 } } 4 }", "{1{2{3}}4}"},
+		{"{ int x = 1; } x", "{int x = 1;}x"},
+	}
+
+	for _, tc := range testCases {
+		p := parser.New(lexer.New(tc.input))
+		assert.Equal(t, tc.expected, parseSource(t, p), tc.input)
+	}
+
+	errorCases := []struct {
+		input    string
+		expected string
+	}{
+		{"{ 1; 2;", "parse error at 1:8: expected '}', found end of input"},
+		{"{ { 1 }", "parse error at 1:8: expected '}', found end of input"},
+		{"if (x) { { 1 }", "parse error at 1:15: expected '}', found end of input"},
+	}
+
+	for _, tc := range errorCases {
+		p := parser.New(lexer.New(tc.input))
+		p.ParseProgram()
+		assert.Equal(t, []string{tc.expected}, p.Errors(), tc.input)
+	}
+}
+
+// TestParseForStatement 验证 for 循环各子句的解析，省略的子句为空
+func TestParseForStatement(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"for (int i = 0; i < 5; i = i + 1) { i }", "for (int i = 0; (i < 5); (i = (i + 1))) {i}"},
+		{"for (i = 0; i < 5;) {}", "for ((i = 0); (i < 5); ) {}"},
+		{"for (;;) {}", "for (; ; ) {}"},
+	}
+
+	for _, tc := range testCases {
+		p := parser.New(lexer.New(tc.input))
+		assert.Equal(t, tc.expected, parseSource(t, p), tc.input)
+	}
+
+	errorCases := []struct {
+		input    string
+		expected string
+	}{
+		{"for (int i = 0 i < 5; i) {}", "parse error at 1:16: expected ';', found 'i'"},
+		{"for (; i < 5 i) {}", "parse error at 1:14: expected ';', found 'i'"},
+		{"for (;; i {}", "parse error at 1:11: expected ')', found '{'"},
+		{"for (;;) i", "parse error at 1:10: expected '{', found 'i'"},
+		// 初始化子句只能是变量声明或表达式
+		{`for (printf("x"); false;) {}`, "parse error at 1:6: expected declaration or expression, found 'printf'"},
+		{"for (if (true) {}; false;) {}", "parse error at 1:6: expected declaration or expression, found 'if'"},
+		{"for ({}; false;) {}", "parse error at 1:6: expected declaration or expression, found '{'"},
+	}
+
+	for _, tc := range errorCases {
+		p := parser.New(lexer.New(tc.input))
+		p.ParseProgram()
+		assert.Contains(t, p.Errors(), tc.expected, tc.input)
+	}
+}
+
+// TestParsePrintfStatement 验证输出语句的格式字符串和参数列表
+func TestParsePrintfStatement(t *testing.T) {
+	p := parser.New(lexer.New(`printf("%d %d", x, 1 + 2);`))
+	assert.Equal(t, `printf("%d %d", x, (1 + 2));`, parseSource(t, p))
+
+	p = parser.New(lexer.New(`printf("x" 1)`))
+	p.ParseProgram()
+	assert.Contains(t, p.Errors(), "parse error at 1:12: expected ')', found '1'")
+}
+
+// TestParseErrorPosition 验证语法错误带有出错词法单元的行号和列号
+func TestParseErrorPosition(t *testing.T) {
+	p := parser.New(lexer.New("1 + 2;\n\n3 +\n    99999999999999999999;"))
+	p.ParseProgram()
+	assert.Equal(t, []string{`parse error at 4:5: could not parse "99999999999999999999" as integer`}, p.Errors())
+}
+
+// TestExpectPeekMismatch 验证期望的下一个词法单元不符时的错误信息
+func TestExpectPeekMismatch(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"int 5 = 1;", "parse error at 1:5: expected identifier, found '5'"},
+		{"while", "parse error at 1:6: expected '(', found end of input"},
+		{"printf(\"%d\", 1;", "parse error at 1:15: expected ')', found ';'"},
+		// 缺少表达式时同样使用 expected X, found Y 的形式
+		{"1 +", "parse error at 1:4: expected expression, found end of input"},
+		{"int x = ;", "parse error at 1:9: expected expression, found ';'"},
+		{"* 2", "parse error at 1:1: expected expression, found '*'"},
+	}
+
+	for _, tc := range testCases {
+		p := parser.New(lexer.New(tc.input))
+		p.ParseProgram()
+		if assert.NotEmpty(t, p.Errors(), tc.input) {
+			assert.Equal(t, tc.expected, p.Errors()[0], tc.input)
+		}
+	}
+}
+
+// TestParsePrecedence 验证比较、加减、乘除、乘方、前缀运算和分组之间的优先级
+func TestParsePrecedence(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2 * 3 == 7", "((1 + (2 * 3)) == 7)"},
+		{"1 + 2 < 4 == true", "(((1 + 2) < 4) == true)"},
+		{"-2 ** 2", "(-(2 ** 2))"},
+		{"-2 ** 2 * 3", "((-(2 ** 2)) * 3)"},
+		{"!1 == 0", "((!1) == 0)"},
+		{"2 * (3 + 4) % 5 >= 1 - -1", "(((2 * (3 + 4)) % 5) >= (1 - (-1)))"},
+		{"x = 1 + 2 != 3", "(x = ((1 + 2) != 3))"},
+	}
+
+	for _, tc := range testCases {
+		p := parser.New(lexer.New(tc.input))
+		assert.Equal(t, tc.expected, parseSource(t, p), tc.input)
+	}
+}
+
+// TestFormatMinimalParens 验证 Format 只保留按优先级和结合性必需的括号，且打印结果重新解析后不变
+func TestFormatMinimalParens(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"((1+2))", "1 + 2;"},
+		{"1+2", "1 + 2;"},
+		{"((1))", "1;"},
+		{"(1+2)*3", "(1 + 2) * 3;"},
+		{"1+(2*3)", "1 + 2 * 3;"},
+		{"(1-2)-3", "1 - 2 - 3;"},
+		{"1-(2-3)", "1 - (2 - 3);"},
+		{"2**(3**2)", "2 ** 3 ** 2;"},
+		{"(2**3)**2", "(2 ** 3) ** 2;"},
+		{"-(1+2)", "-(1 + 2);"},
+		{"-(2**2)", "-2 ** 2;"},
+		{"(-2)**2", "(-2) ** 2;"},
+		{"2**(-2)", "2 ** -2;"},
+		{"!(a == b)", "!(a == b);"},
+		{"(a < b) == (c > d)", "a < b == c > d;"},
+		{"x = (y = (1 + 2))", "x = y = 1 + 2;"},
+		{"(x = 1) + 2", "(x = 1) + 2;"},
+		{"((char)(65)) + 1", "(char)65 + 1;"},
+		{"(int)(x + 1)", "(int)(x + 1);"},
+		{"int x = (1); if ((x > 0)) { printf(\"%d\", (x)); } else { x = (x - 1); }",
+			`int x = 1; if (x > 0) {printf("%d", x);} else {x = x - 1;}`},
+		{"for (int i = (0); (i < 3); i = (i + 1)) { while ((i)) { break; } }",
+			"for (int i = 0; i < 3; i = i + 1) {while (i) {break;}}"},
+	}
+
+	for _, tc := range testCases {
+		p := parser.New(lexer.New(tc.input))
+		program := p.ParseProgram()
+		assert.Empty(t, p.Errors(), tc.input)
+
+		formatted := p.Format(program)
+		assert.Equal(t, tc.expected, formatted, tc.input)
+
+		// 去掉多余括号不改变语法树
+		reparsed := parser.New(lexer.New(formatted))
+		assert.Equal(t, program.String(), parseSource(t, reparsed), tc.input)
+	}
+}
@@ -0,0 +1,75 @@
+package test_test
+
+import (
+	"Butterfly/lexer"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// lexValues 对输入进行词法分析，返回除 EOF 之外所有词法单元的值
+func lexValues(input string) []string {
+	l := lexer.New(input)
+	var values []string
+	for {
+		token := l.NextToken()
+		if token.Type == lexer.EOF {
+			break
+		}
+		values = append(values, token.Value)
+	}
+	return values
+}
+
+// TestPreprocessIf 验证 #if 区域只在名称被定义时保留
+func TestPreprocessIf(t *testing.T) {
+	input := "1\n#if FOO\n+ 2\n#endif\n+ 3"
+
+	testCases := []struct {
+		name     string
+		defines  map[string]bool
+		expected []string
+	}{
+		{"未定义FOO", nil, []string{"1", "+", "3"}},
+		{"定义FOO", map[string]bool{"FOO": true}, []string{"1", "+", "2", "+", "3"}},
+		{"定义其他名称", map[string]bool{"BAR": true}, []string{"1", "+", "3"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			output, err := lexer.Preprocess(input, tc.defines)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, lexValues(output))
+		})
+	}
+}
+
+// TestPreprocessKeepsLines 验证被跳过的区域不影响后续词法单元的行号
+func TestPreprocessKeepsLines(t *testing.T) {
+	output, err := lexer.Preprocess("#if FOO\n1\n#endif\n2", nil)
+	assert.NoError(t, err)
+
+	token := lexer.New(output).NextToken()
+	assert.Equal(t, "2", token.Value)
+	assert.Equal(t, 4, token.Line)
+}
+
+// TestPreprocessNested 验证嵌套区域在外层未启用时同样被跳过
+func TestPreprocessNested(t *testing.T) {
+	input := "#if A\n#if B\n1\n#endif\n#endif\n2"
+
+	output, err := lexer.Preprocess(input, map[string]bool{"B": true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2"}, lexValues(output))
+
+	output, err = lexer.Preprocess(input, map[string]bool{"A": true, "B": true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, lexValues(output))
+}
+
+// TestPreprocessErrors 验证不匹配的指令返回错误
+func TestPreprocessErrors(t *testing.T) {
+	for _, input := range []string{"#if FOO\n1", "1\n#endif", "#if\n#endif", "#define X"} {
+		_, err := lexer.Preprocess(input, nil)
+		assert.Error(t, err, input)
+	}
+}
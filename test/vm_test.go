@@ -0,0 +1,810 @@
+package test_test
+
+import (
+	"Butterfly/compiler"
+	"Butterfly/lexer"
+	"Butterfly/parser"
+	"Butterfly/vm"
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+	"time"
+)
+
+// runSource 编译并执行输入，返回虚拟机实例和执行错误
+func runSource(t *testing.T, input string) (*vm.VM, error) {
+	machine := vm.New(compileSource(t, input))
+	return machine, machine.Run()
+}
+
+// TestArithmetic 验证整数运算的执行结果
+func TestArithmetic(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1 + 2", int64(3)},
+		{"1 - 2 - 3", int64(-4)},
+		{"2 ** 10", int64(1024)},
+		{"2 ** 3 ** 2", int64(512)},
+		{"5 ** 0", int64(1)},
+		{"2 * 3 + 4", int64(10)},
+		{"2 + 3 * 4", int64(14)},
+		{"100 / 5 / 2", int64(10)},
+		{"7 / 2", int64(3)},
+		{"1 + 6 / 3 - 2 * 2", int64(-1)},
+		{"(1 + 2) * 3", int64(9)},
+		{"((1 + 2))", int64(3)},
+		{"(5 - (3 - 1)) * (2 + 2)", int64(12)},
+		{"10 % 3", int64(1)},
+		{"2 + 10 % 4 * 3", int64(8)},
+		{"0xFF + 0b1 - 010", int64(248)},
+		{"0x10 * 0b11 + 10", int64(58)},
+	}
+
+	for _, tc := range testCases {
+		machine, err := runSource(t, tc.input)
+		assert.NoError(t, err, tc.input)
+		assert.Equal(t, tc.expected, machine.LastPoppedStackElem(), tc.input)
+	}
+}
+
+// TestSandboxDeny 验证沙箱模式下执行被禁止的操作码返回错误
+func TestSandboxDeny(t *testing.T) {
+	bytecode := compileSource(t, "1 + 2 ** 3")
+
+	machine := vm.New(bytecode)
+	machine.Deny(compiler.OpPow)
+	err := machine.Run()
+	assert.EqualError(t, err, "opcode OpPow disabled in sandbox")
+
+	// 未被禁止的操作码照常执行
+	machine = vm.New(bytecode)
+	machine.Deny(compiler.OpSub)
+	assert.NoError(t, machine.Run())
+	assert.Equal(t, int64(9), machine.LastPoppedStackElem())
+
+	// 禁止 OpPrint 后 printf 不会产生任何输出
+	var out bytes.Buffer
+	machine = vm.NewWithOutput(compileSource(t, `printf("x=%d", 5);`), &out)
+	machine.Deny(compiler.OpPrint)
+	assert.EqualError(t, machine.Run(), "opcode OpPrint disabled in sandbox")
+	assert.Empty(t, out.String())
+}
+
+// TestLastPoppedFullStack 验证栈被压满时 LastPoppedStackElem 返回 nil 而不会越界
+func TestLastPoppedFullStack(t *testing.T) {
+	ins := make(compiler.Instructions, 0, vm.StackSize)
+	for i := 0; i < vm.StackSize; i++ {
+		ins = append(ins, compiler.Make(compiler.OpTrue)...)
+	}
+
+	machine := vm.New(&compiler.Bytecode{Instructions: ins})
+	assert.NoError(t, machine.Run())
+	assert.Nil(t, machine.LastPoppedStackElem())
+}
+
+// TestCompileAndVerify 验证各阶段的错误和警告被合并并按源码位置排序
+func TestCompileAndVerify(t *testing.T) {
+	bytecode, diagnostics := vm.CompileAndVerify("char c = 300;\nint y = (1 + 2;\n1 @ 2;\n")
+	assert.Nil(t, bytecode)
+	assert.Equal(t, []vm.Diagnostic{
+		{Severity: vm.SeverityWarning, Stage: "compiler", Line: 1, Column: 1, Message: "integer 300 out of range for char"},
+		{Severity: vm.SeverityError, Stage: "parser", Line: 2, Column: 15, Message: "expected ')', found ';'"},
+		{Severity: vm.SeverityError, Stage: "lexer", Line: 3, Column: 3, Message: "Unexpected character: @ at 3:3"},
+	}, diagnostics)
+	assert.Equal(t, "1:1: warning: integer 300 out of range for char", diagnostics[0].String())
+
+	// 编译错误带有出错节点的位置
+	_, diagnostics = vm.CompileAndVerify("int x = 1;\nx + y")
+	assert.Equal(t, []vm.Diagnostic{{Severity: vm.SeverityError, Stage: "compiler", Line: 2, Column: 5, Message: "undefined variable y"}}, diagnostics)
+
+	// 只有警告时仍然返回字节码
+	bytecode, diagnostics = vm.CompileAndVerify("int x = 1; x = x;")
+	assert.NotNil(t, bytecode)
+	assert.Equal(t, []vm.Diagnostic{{Severity: vm.SeverityWarning, Stage: "compiler", Line: 1, Column: 14, Message: "self-assignment has no effect"}}, diagnostics)
+
+	bytecode, diagnostics = vm.CompileAndVerify("1 + 2")
+	assert.NoError(t, vm.New(bytecode).Run())
+	assert.Empty(t, diagnostics)
+}
+
+// TestRunContext 验证 context 取消或超时后虚拟机停止执行，并在错误中附带行号
+func TestRunContext(t *testing.T) {
+	machine := vm.New(compileSource(t, "int i = 0;\nwhile (true) { i = i + 1; }"))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := machine.RunContext(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, err.Error(), "runtime error at line 2: ")
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, vm.New(compileSource(t, "while (true) {}")).RunContext(ctx), context.Canceled)
+
+	// 未取消时与 Run 相同
+	machine = vm.New(compileSource(t, "1 + 2"))
+	assert.NoError(t, machine.RunContext(context.Background()))
+	assert.Equal(t, int64(3), machine.LastPoppedStackElem())
+}
+
+// TestStatementSequence 验证多条语句依次执行，每条语句结束后栈被清空
+func TestStatementSequence(t *testing.T) {
+	machine, err := runSource(t, "1+2; 3+4;")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), machine.LastPoppedStackElem())
+	assert.Nil(t, machine.StackTop())
+
+	machine, err = runSource(t, "1+2;;;")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), machine.LastPoppedStackElem())
+}
+
+// TestVerify 验证字节码校验能接受合法字节码并拒绝各类非法字节码
+func TestVerify(t *testing.T) {
+	assert.NoError(t, vm.Verify(compileSource(t, "1 + 2 ** 3 - 4")))
+
+	testCases := []struct {
+		name     string
+		bytecode *compiler.Bytecode
+		expected string
+	}{
+		{
+			"未知操作码",
+			&compiler.Bytecode{Instructions: compiler.Instructions{byte(compiler.OpAdd), 0xFF}},
+			"unknown opcode 255 at offset 1",
+		},
+		{
+			"操作数被截断",
+			&compiler.Bytecode{
+				Instructions: compiler.Instructions{byte(compiler.OpConstant), 0},
+				Constants:    []interface{}{int64(1)},
+			},
+			"truncated operand for OpConstant at offset 0",
+		},
+		{
+			"常量索引越界",
+			&compiler.Bytecode{
+				Instructions: compiler.Instructions{byte(compiler.OpConstant), 0, 0, byte(compiler.OpConstant), 0, 1},
+				Constants:    []interface{}{int64(1)},
+			},
+			"constant index 1 out of range at offset 3",
+		},
+		{
+			"跳转到指令中间",
+			&compiler.Bytecode{
+				Instructions: compiler.Instructions{byte(compiler.OpJump), 0, 4, byte(compiler.OpConstant), 0, 0},
+				Constants:    []interface{}{int64(1)},
+			},
+			"invalid jump target 4 at offset 0",
+		},
+		{
+			"跳转越过末尾",
+			&compiler.Bytecode{Instructions: compiler.Instructions{byte(compiler.OpTrue), byte(compiler.OpJumpNotTruthy), 0, 5}},
+			"invalid jump target 5 at offset 1",
+		},
+		{
+			"printf 缺少格式字符串",
+			&compiler.Bytecode{Instructions: compiler.Instructions{byte(compiler.OpTrue), byte(compiler.OpPrint), 0}},
+			"OpPrint without format string at offset 1",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.EqualError(t, vm.Verify(tc.bytecode), tc.expected)
+		})
+	}
+}
+
+// TestFloatArithmetic 验证浮点运算以及整数与浮点数混合运算时的类型提升
+func TestFloatArithmetic(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14", 3.14},
+		{"1.0 + 2", 3.0},
+		{"2 * 1.5", 3.0},
+		{"7 / 2.0", 3.5},
+		{"0.5 - 1", -0.5},
+		{"2.0 ** 3", 8.0},
+		{"7.5 % 2", 1.5},
+	}
+
+	for _, tc := range testCases {
+		machine, err := runSource(t, tc.input)
+		assert.NoError(t, err, tc.input)
+		assert.Equal(t, tc.expected, machine.LastPoppedStackElem(), tc.input)
+	}
+}
+
+// TestComparison 验证比较运算在栈顶留下布尔结果
+func TestComparison(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected bool
+	}{
+		{"1 < 2", true},
+		{"2 < 1", false},
+		{"2 == 2", true},
+		{"3 != 3", false},
+		{"3 > 2", true},
+		{"2 >= 2", true},
+		{"3 <= 2", false},
+		{"1 + 2 * 3 == 7", true},
+		{"1.5 < 2", true},
+		{"2.0 == 2", true},
+		{"(1 < 2) == (3 < 4)", true},
+		{"(1 < 2) != (3 > 4)", true},
+	}
+
+	for _, tc := range testCases {
+		machine, err := runSource(t, tc.input)
+		assert.NoError(t, err, tc.input)
+		assert.Equal(t, tc.expected, machine.LastPoppedStackElem(), tc.input)
+	}
+}
+
+// TestNegation 验证一元负号
+func TestNegation(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"-5", int64(-5)},
+		{"-(1+2)", int64(-3)},
+		{"--5", int64(5)},
+		{"3 - -2", int64(5)},
+		{"-2 * 3 + 10", int64(4)},
+		{"-1.5", -1.5},
+	}
+
+	for _, tc := range testCases {
+		machine, err := runSource(t, tc.input)
+		assert.NoError(t, err, tc.input)
+		assert.Equal(t, tc.expected, machine.LastPoppedStackElem(), tc.input)
+	}
+
+	_, err := runSource(t, "2 ** -1")
+	assert.EqualError(t, err, "runtime error at line 1: negative exponent: -1")
+
+	_, err = runSource(t, "-true")
+	assert.EqualError(t, err, "runtime error at line 1: unsupported operand type for negation: bool")
+}
+
+// TestBooleanAndBang 验证布尔字面量以及 ! 对任意值真假性的取反
+func TestBooleanAndBang(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected bool
+	}{
+		{"true", true},
+		{"false", false},
+		{"!false", true},
+		{"!!true", true},
+		{"!0", true},
+		{"!5", false},
+		{"!0.0", true},
+		{"!(1 > 2)", true},
+		{"true == !false", true},
+	}
+
+	for _, tc := range testCases {
+		machine, err := runSource(t, tc.input)
+		assert.NoError(t, err, tc.input)
+		assert.Equal(t, tc.expected, machine.LastPoppedStackElem(), tc.input)
+	}
+}
+
+// TestCharLiteral 验证字符字面量按码点参与比较和算术运算
+func TestCharLiteral(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"'a'", int64(97)},
+		{"'a' + 1", int64(98)},
+		{"'z' - 'a'", int64(25)},
+		{"'a' == 'a'", true},
+		{"'a' != 'b'", true},
+		{"'a' < 'b'", true},
+		{`'\n'`, int64(10)},
+		{`'\0'`, int64(0)},
+	}
+
+	for _, tc := range testCases {
+		machine, err := runSource(t, tc.input)
+		assert.NoError(t, err, tc.input)
+		assert.Equal(t, tc.expected, machine.LastPoppedStackElem(), tc.input)
+	}
+}
+
+// TestStringNotEqual 验证字符串的 != 是 == 的否定，按内容比较
+func TestStringNotEqual(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"a" != "b"`, true},
+		{`"a" != "a"`, false},
+		{`"ab" != "a" + "b"`, false},
+		{`"" != ""`, false},
+		{`"a" != "ab"`, true},
+	}
+
+	for _, tc := range testCases {
+		machine, err := runSource(t, tc.input)
+		assert.NoError(t, err, tc.input)
+		assert.Equal(t, tc.expected, machine.LastPoppedStackElem(), tc.input)
+	}
+
+	// 不同类型的值不能比较
+	_, err := runSource(t, `"a" != 1`)
+	assert.EqualError(t, err, "runtime error at line 1: unsupported operand types for OpNotEqual: string and int64")
+}
+
+// TestCharIntComparison 验证字符与整数都是 int64，可以直接互相比较
+func TestCharIntComparison(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"'A' == 65", true},
+		{"65 == 'A'", true},
+		{"'0' + 5 == '5'", true},
+		{"'A' != 65", false},
+		{"'a' > 65", true},
+		{"int n = 66; char c = 'B'; c == n", true},
+	}
+
+	for _, tc := range testCases {
+		machine, err := runSource(t, tc.input)
+		assert.NoError(t, err, tc.input)
+		assert.Equal(t, tc.expected, machine.LastPoppedStackElem(), tc.input)
+	}
+}
+
+// TestStringLiteral 验证字符串字面量、拼接和相等比较
+func TestStringLiteral(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"foo"`, "foo"},
+		{`"foo" + "bar"`, "foobar"},
+		{`"a" + "b" + "c"`, "abc"},
+		{`"a\tb"`, "a\tb"},
+		{`"a\0b"`, "a\x00b"},
+		{`"ab" == "a" + "b"`, true},
+	}
+
+	for _, tc := range testCases {
+		machine, err := runSource(t, tc.input)
+		assert.NoError(t, err, tc.input)
+		assert.Equal(t, tc.expected, machine.LastPoppedStackElem(), tc.input)
+	}
+
+	_, err := runSource(t, `"x" - "y"`)
+	assert.EqualError(t, err, "runtime error at line 1: unsupported operand types for OpSub: string and string")
+
+	_, err = runSource(t, `"x" + 1`)
+	assert.EqualError(t, err, "runtime error at line 1: unsupported operand types for OpAdd: string and int64")
+}
+
+// TestStringRepeat 验证字符串与整数相乘时重复字符串，次数为负或结果过长时运行出错
+func TestStringRepeat(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"ab" * 3`, "ababab"},
+		{`3 * "ab"`, "ababab"},
+		{`"ab" * 0`, ""},
+		{`"" * 1000000000`, ""},
+		{`int n = 2; "-" * (n + 1) + "|"`, "---|"},
+	}
+
+	for _, tc := range testCases {
+		machine, err := runSource(t, tc.input)
+		assert.NoError(t, err, tc.input)
+		assert.Equal(t, tc.expected, machine.LastPoppedStackElem(), tc.input)
+	}
+
+	_, err := runSource(t, `"ab" * -1`)
+	assert.EqualError(t, err, "runtime error at line 1: negative repeat count: -1")
+
+	_, err = runSource(t, `"ab" * 9223372036854775807`)
+	assert.EqualError(t, err, "runtime error at line 1: repeated string too long: limit is 1048576 bytes")
+
+	// 上限可以调整，恰好等于上限的结果是允许的
+	machine := vm.New(compileSource(t, `"ab" * 2`))
+	machine.SetMaxRepeatLength(4)
+	assert.NoError(t, machine.Run())
+	assert.Equal(t, "abab", machine.LastPoppedStackElem())
+
+	machine = vm.New(compileSource(t, `"ab" * 3`))
+	machine.SetMaxRepeatLength(4)
+	assert.EqualError(t, machine.Run(), "runtime error at line 1: repeated string too long: limit is 4 bytes")
+
+	_, err = runSource(t, `"ab" * "c"`)
+	assert.EqualError(t, err, "runtime error at line 1: unsupported operand types for OpMul: string and string")
+}
+
+// TestGlobalVariables 验证变量声明后可以读取其值
+func TestGlobalVariables(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"int x = 5; x;", int64(5)},
+		{"int x = 2; x + 3;", int64(5)},
+		{"int x = 1; int y = x + 1; x + y;", int64(3)},
+		{"char c = 'a'; c + 1;", int64(98)},
+		{"int z; z;", int64(0)},
+		{"int x = 1; x = x + 1; x;", int64(2)},
+		{"int x = 1; x = 10;", int64(10)},
+		{"int x; int y; x = y = 3; x + y;", int64(6)},
+		{"{ int x = 1; { x = x + 1; } } x;", int64(2)}, // 语句块暂不引入新的作用域
+	}
+
+	for _, tc := range testCases {
+		machine, err := runSource(t, tc.input)
+		assert.NoError(t, err, tc.input)
+		assert.Equal(t, tc.expected, machine.LastPoppedStackElem(), tc.input)
+	}
+}
+
+// TestIfStatement 验证条件语句根据条件的真假选择分支
+func TestIfStatement(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"if (1 < 2) { 10 } else { 20 }", int64(10)},
+		{"if (1 > 2) { 10 } else { 20 }", int64(20)},
+		{"if (true) { 10 }", int64(10)},
+		{"int x = 0; if (x) { 1 } else if (x == 0) { 2 } else { 3 }", int64(2)},
+		{"int x = 5; if (x > 3) { x = x * 2; } x;", int64(10)},
+		{"int x = 5; if (x > 9) { x = 0; } else { x = x + 1; x = x + 1; } x;", int64(7)},
+	}
+
+	for _, tc := range testCases {
+		machine, err := runSource(t, tc.input)
+		assert.NoError(t, err, tc.input)
+		assert.Equal(t, tc.expected, machine.LastPoppedStackElem(), tc.input)
+	}
+}
+
+// TestWhileStatement 验证循环按条件重复执行循环体
+func TestWhileStatement(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"int i = 0; while (i < 10) { i = i + 1; } i;", int64(10)},
+		{"int i = 0; int sum = 0; while (i < 5) { i = i + 1; sum = sum + i; } sum;", int64(15)},
+		{"int i = 3; while (false) { i = 0; } i;", int64(3)},
+		{"int n = 10; int steps = 0; while (n != 1) { if (n % 2 == 0) { n = n / 2; } else { n = 3 * n + 1; } steps = steps + 1; } steps;", int64(6)},
+	}
+
+	for _, tc := range testCases {
+		machine, err := runSource(t, tc.input)
+		assert.NoError(t, err, tc.input)
+		assert.Equal(t, tc.expected, machine.LastPoppedStackElem(), tc.input)
+	}
+}
+
+// TestForStatement 验证 for 循环的初始化、条件和更新子句
+func TestForStatement(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"int sum = 0; for (int i = 1; i <= 5; i = i + 1) { sum = sum + i; } sum;", int64(15)},
+		{"int i; int n = 0; for (i = 0; i < 3; i = i + 1) { n = n + 2; } n + i;", int64(9)},
+		{"int i = 0; for (; i < 4;) { i = i + 1; } i;", int64(4)},
+		{"int n = 0; for (int i = 0; false; i = i + 1) { n = 1; } n;", int64(0)},
+		// 初始化子句声明的变量只属于该循环，连续的循环可以各自声明
+		{"int n = 0; for (int i = 0; i < 3; i = i + 1) { n = n + 1; } for (int i = 0; i < 2; i = i + 1) { n = n + 10; } n;", int64(23)},
+		// 循环变量遮蔽同名的外层变量，循环结束后外层变量不受影响
+		{"int i = 7; for (int i = 0; i < 3; i = i + 1) {} i;", int64(7)},
+	}
+
+	for _, tc := range testCases {
+		machine, err := runSource(t, tc.input)
+		assert.NoError(t, err, tc.input)
+		assert.Equal(t, tc.expected, machine.LastPoppedStackElem(), tc.input)
+	}
+}
+
+// TestBreakContinue 验证 break 跳出最内层循环，continue 进入下一次迭代
+func TestBreakContinue(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"int i = 0; while (true) { i = i + 1; if (i == 3) { break; } } i;", int64(3)},
+		{"int i = 0; int n = 0; while (i < 5) { i = i + 1; if (i == 2) { continue; } n = n + 1; } n;", int64(4)},
+		{"int i; for (i = 0; ; i = i + 1) { if (i == 4) { break; } } i;", int64(4)},
+		// break 只跳出内层循环
+		{"int n = 0; for (int i = 0; i < 3; i = i + 1) { while (true) { n = n + 1; break; } } n;", int64(3)},
+	}
+
+	for _, tc := range testCases {
+		machine, err := runSource(t, tc.input)
+		assert.NoError(t, err, tc.input)
+		assert.Equal(t, tc.expected, machine.LastPoppedStackElem(), tc.input)
+	}
+}
+
+// TestForContinue 验证 for 循环中的 continue 先执行更新子句，循环变量照常递增，循环能够结束
+func TestForContinue(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"int sum = 0; for (int i = 0; i < 6; i = i + 1) { if (i % 2 == 1) { continue; } sum = sum + i; } sum;", int64(6)},
+		// 每次迭代都 continue，更新子句仍然执行 5 次
+		{"int i; for (i = 0; i < 5; i = i + 1) { continue; } i;", int64(5)},
+		{"int i; int n = 0; for (i = 0; i < 5; i = i + 1) { if (i < 3) { continue; } n = n + 1; } i * 10 + n;", int64(52)},
+	}
+
+	for _, tc := range testCases {
+		machine, err := runSource(t, tc.input)
+		assert.NoError(t, err, tc.input)
+		assert.Equal(t, tc.expected, machine.LastPoppedStackElem(), tc.input)
+	}
+}
+
+// TestPrintf 验证 printf 按格式写入虚拟机的输出
+func TestPrintf(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{`printf("x=%d", 5)`, "x=5"},
+		{`printf("hello\n");`, "hello\n"},
+		{`int x = 3; printf("%d + %d = %d\n", x, 4, x + 4);`, "3 + 4 = 7\n"},
+		{`printf("%c%c", 'o', 'k')`, "ok"},
+		{`printf("%s, %s!", "hello", "world")`, "hello, world!"},
+		{`printf("%f", 1.5)`, "1.500000"},
+		{`printf("%f", 3.14)`, "3.140000"},
+		{`printf("%.1f", 3.14)`, "3.1"},
+		{`printf("%.2f|%6.2f|%.0f", 3.14159, 2.5, 2.5)`, "3.14|  2.50|2"},
+		{`printf("[%3d][%-3d][%5s]", 7, 7, "ab")`, "[  7][7  ][   ab]"},
+		{`printf("100%%")`, "100%"},
+		{`for (int i = 0; i < 3; i = i + 1) { printf("%d", i); }`, "012"},
+	}
+
+	for _, tc := range testCases {
+		var out bytes.Buffer
+		machine := vm.NewWithOutput(compileSource(t, tc.input), &out)
+		assert.NoError(t, machine.Run(), tc.input)
+		assert.Equal(t, tc.expected, out.String(), tc.input)
+	}
+
+	errorCases := []struct {
+		input    string
+		expected string
+	}{
+		{`printf("%d")`, "runtime error at line 1: printf: too few arguments for %d"},
+		{`printf("x", 1)`, "runtime error at line 1: printf: too many arguments"},
+		{`printf("%d", "a")`, "runtime error at line 1: printf: %d expects an integer, got string"},
+		{`printf("%f", 3)`, "runtime error at line 1: printf: %f expects a float, got int64"},
+		{`printf("%.2f", "x")`, "runtime error at line 1: printf: %f expects a float, got string"},
+		{`printf("%5", 1)`, "runtime error at line 1: printf: format ends with %5"},
+		{`printf("%q", 1)`, "runtime error at line 1: printf: unknown verb %q"},
+		{`printf(1)`, "runtime error at line 1: printf: format must be a string, got int64"},
+	}
+
+	for _, tc := range errorCases {
+		var out bytes.Buffer
+		machine := vm.NewWithOutput(compileSource(t, tc.input), &out)
+		assert.EqualError(t, machine.Run(), tc.expected, tc.input)
+	}
+
+	// 手工构造的 OpPrint 0 没有格式字符串可弹出
+	machine := vm.New(&compiler.Bytecode{Instructions: compiler.Make(compiler.OpPrint, 0)})
+	assert.EqualError(t, machine.Run(), "runtime error: printf: missing format string")
+}
+
+// TestCastExpression 验证类型转换只改变类型，printf 按转换后的类型输出
+func TestCastExpression(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{`printf("%c", (char)65)`, "A"},
+		{`printf("%d", (int)'A')`, "65"},
+		{`int x = 66; printf("%c%d", (char)x, (int)(char)x + 1)`, "B67"},
+	}
+
+	for _, tc := range testCases {
+		var out bytes.Buffer
+		machine := vm.NewWithOutput(compileSource(t, tc.input), &out)
+		assert.NoError(t, machine.Run(), tc.input)
+		assert.Equal(t, tc.expected, out.String(), tc.input)
+	}
+}
+
+// TestOutputRouting 验证每个虚拟机的输出只写入各自的 io.Writer
+func TestOutputRouting(t *testing.T) {
+	var first, second bytes.Buffer
+	a := vm.NewWithOutput(compileSource(t, `printf("a")`), &first)
+	b := vm.NewWithOutput(compileSource(t, `printf("b")`), &second)
+
+	assert.NoError(t, a.Run())
+	assert.NoError(t, b.Run())
+	assert.NoError(t, a.Run())
+	assert.Equal(t, "aa", first.String())
+	assert.Equal(t, "b", second.String())
+}
+
+// TestInt32Mode 验证32位模式下整数运算回绕且超出范围的字面量是编译错误
+func TestInt32Mode(t *testing.T) {
+	compile32 := func(input string) (*compiler.Bytecode, error) {
+		p := parser.New(lexer.New(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("语法分析错误: %v", p.Errors())
+		}
+		c := compiler.New()
+		c.EnableInt32Mode()
+		err := c.Compile(program)
+		return c.Bytecode(), err
+	}
+
+	testCases := []struct {
+		input    string
+		expected int64
+	}{
+		{"2147483647 + 1", math.MinInt32},
+		{"-2147483647 - 2", math.MaxInt32},
+		{"65536 * 65536", 0},
+		{"2 ** 31", math.MinInt32},
+		{"int x = -2147483647 - 1; -x", math.MinInt32},
+		{"100 * 3", 300},
+	}
+
+	for _, tc := range testCases {
+		bytecode, err := compile32(tc.input)
+		if assert.NoError(t, err, tc.input) {
+			machine := vm.New(bytecode)
+			machine.EnableInt32Mode()
+			assert.NoError(t, machine.Run(), tc.input)
+			assert.Equal(t, tc.expected, machine.LastPoppedStackElem(), tc.input)
+		}
+	}
+
+	_, err := compile32("2147483648")
+	assert.EqualError(t, err, "integer literal 2147483648 out of range for 32-bit int")
+
+	// 默认的64位模式不受影响
+	machine, err := runSource(t, "2147483647 + 1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2147483648), machine.LastPoppedStackElem())
+}
+
+// TestPrecedence 验证按优先级解析后的执行结果
+func TestPrecedence(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1 + 2 * 3 == 7", true},
+		{"(1 + 2) * 3 == 7", false},
+		{"2 * 3 ** 2 - 10 % 4", int64(16)},
+		{"-2 ** 2", int64(-4)},
+		{"(-2) ** 2", int64(4)},
+		{"1 + 2 < 4 == true", true},
+	}
+
+	for _, tc := range testCases {
+		machine, err := runSource(t, tc.input)
+		assert.NoError(t, err, tc.input)
+		assert.Equal(t, tc.expected, machine.LastPoppedStackElem(), tc.input)
+	}
+}
+
+// TestComparisonTypeMismatch 验证布尔值不能进行大小比较
+func TestComparisonTypeMismatch(t *testing.T) {
+	_, err := runSource(t, "(1 < 2) > 0")
+	assert.EqualError(t, err, "runtime error at line 1: unsupported operand types for OpGreaterThan: bool and int64")
+}
+
+// TestDivisionByZero 验证整数除以零返回错误而不是崩溃
+func TestDivisionByZero(t *testing.T) {
+	_, err := runSource(t, "6 / 0")
+	assert.EqualError(t, err, "runtime error at line 1: division by zero")
+
+	_, err = runSource(t, "1 + 6 / (2 - 2)")
+	assert.EqualError(t, err, "runtime error at line 1: division by zero")
+}
+
+// TestRuntimeErrorLine 验证执行错误指出出错语句所在的行
+func TestRuntimeErrorLine(t *testing.T) {
+	_, err := runSource(t, "1 + 2;\n3 * 4;\n\n10 /\n (5 - 5);")
+	assert.EqualError(t, err, "runtime error at line 4: division by zero")
+
+	// 没有位置信息的字节码只报告错误本身
+	ins, err := compiler.Assemble("OpConstant 0\nOpConstant 1\nOpDiv")
+	assert.NoError(t, err)
+	machine := vm.New(&compiler.Bytecode{Instructions: ins, Constants: []interface{}{int64(1), int64(0)}})
+	assert.EqualError(t, machine.Run(), "runtime error: division by zero")
+}
+
+// TestModuloByZero 验证对零取模返回错误而不是崩溃
+func TestModuloByZero(t *testing.T) {
+	_, err := runSource(t, "5 % 0")
+	assert.EqualError(t, err, "runtime error at line 1: modulo by zero")
+}
+
+// TestLastPoppedStackElem 验证 LastPoppedStackElem 与 StackTop 的区别：
+// 表达式语句的值被 OpPop 弹出后栈为空，只能通过 LastPoppedStackElem 取得
+func TestLastPoppedStackElem(t *testing.T) {
+	machine, err := runSource(t, "1 + 2")
+	assert.NoError(t, err)
+	assert.Nil(t, machine.StackTop())
+	assert.Equal(t, int64(3), machine.LastPoppedStackElem())
+
+	machine, err = runSource(t, "(1 + 2) * 4")
+	assert.NoError(t, err)
+	assert.Nil(t, machine.StackTop())
+	assert.Equal(t, int64(12), machine.LastPoppedStackElem())
+}
+
+// TestRunner 验证同一个 Runner 连续执行多个程序时互不影响
+func TestRunner(t *testing.T) {
+	runner := vm.NewRunner()
+
+	result, err := runner.Run(compileSource(t, "1 + 2 * 3"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), result)
+
+	// 出错的程序不影响之后的运行
+	_, err = runner.Run(compileSource(t, "(1 + 2) % 0"))
+	assert.Error(t, err)
+
+	result, err = runner.Run(compileSource(t, "10 > 3"))
+	assert.NoError(t, err)
+	assert.Equal(t, true, result)
+
+	// 空程序不会返回上一个程序的结果
+	result, err = runner.Run(compileSource(t, ""))
+	assert.NoError(t, err)
+	assert.Nil(t, result)
+
+	// 全局变量不会带入下一次运行
+	_, err = runner.Run(compileSource(t, "int x = 5;"))
+	assert.NoError(t, err)
+	ins, err := compiler.Assemble("OpGetGlobal 0\nOpPop")
+	assert.NoError(t, err)
+	result, err = runner.Run(&compiler.Bytecode{Instructions: ins})
+	assert.NoError(t, err)
+	assert.Nil(t, result)
+}
+
+// BenchmarkRunner 使用同一个 Runner 批量执行小程序
+func BenchmarkRunner(b *testing.B) {
+	var programs []*compiler.Bytecode
+	for _, input := range []string{"1 + 2 * 3", "(4 - 1) ** 2 % 5", "2.5 * 4 > 9", "!(1 == 2)"} {
+		p := parser.New(lexer.New(input))
+		c := compiler.New()
+		if err := c.Compile(p.ParseProgram()); err != nil {
+			b.Fatal(err)
+		}
+		programs = append(programs, c.Bytecode())
+	}
+
+	runner := vm.NewRunner()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := runner.Run(programs[i%len(programs)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
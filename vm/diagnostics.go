@@ -0,0 +1,100 @@
+package vm
+
+import (
+	"Butterfly/compiler"
+	"Butterfly/lexer"
+	"Butterfly/parser"
+	"fmt"
+	"sort"
+)
+
+// Severity 表示诊断信息的严重程度
+type Severity int
+
+const (
+	SeverityError   Severity = iota // 错误，存在错误时不生成字节码
+	SeverityWarning                 // 警告，不影响字节码的生成
+)
+
+// String 返回严重程度的名称
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+// Diagnostic 是编译流程中某个阶段产生的一条诊断信息
+// 与具体源码位置无关的诊断（如字节码校验失败）行号和列号为 0
+type Diagnostic struct {
+	Severity Severity
+	Stage    string // 产生诊断的阶段：lexer、parser、compiler 或 verify
+	Line     int
+	Column   int
+	Message  string
+}
+
+// String 将诊断格式化为 "行:列: 严重程度: 信息"
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s: %s", d.Line, d.Column, d.Severity, d.Message)
+}
+
+// CompileAndVerify 对源代码执行完整的词法分析、语法分析、编译和字节码校验，
+// 返回字节码以及各阶段产生的全部错误和警告，按源码位置排序。
+// 词法错误不会中止分析，出错的字符被跳过，之后的错误和警告仍会报告；
+// 存在任何错误时返回的字节码为 nil。
+func CompileAndVerify(src string) (*compiler.Bytecode, []Diagnostic) {
+	var diagnostics []Diagnostic
+
+	l := lexer.New(src)
+	l.EnableRecovery()
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	for _, err := range l.Errors() {
+		diagnostics = append(diagnostics, Diagnostic{SeverityError, "lexer", err.Line, err.Column, err.Message})
+	}
+	for _, err := range p.ErrorDetails() {
+		diagnostics = append(diagnostics, Diagnostic{SeverityError, "parser", err.Line, err.Column, err.Message})
+	}
+
+	// 即使前面的阶段有错误也继续编译语法正确的部分，以便报告其中的警告
+	c := compiler.New()
+	compileErr := c.Compile(program)
+	for _, w := range c.WarningDetails() {
+		diagnostics = append(diagnostics, Diagnostic{SeverityWarning, "compiler", w.Pos.Line, w.Pos.Column, w.Message})
+	}
+	if compileErr != nil {
+		pos, _ := c.ErrorPosition()
+		diagnostics = append(diagnostics, Diagnostic{SeverityError, "compiler", pos.Line, pos.Column, compileErr.Error()})
+	}
+
+	bytecode := c.Bytecode()
+	if !hasErrors(diagnostics) {
+		if err := Verify(bytecode); err != nil {
+			diagnostics = append(diagnostics, Diagnostic{SeverityError, "verify", 0, 0, err.Error()})
+		}
+	}
+
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		if diagnostics[i].Line != diagnostics[j].Line {
+			return diagnostics[i].Line < diagnostics[j].Line
+		}
+		return diagnostics[i].Column < diagnostics[j].Column
+	})
+
+	if hasErrors(diagnostics) {
+		return nil, diagnostics
+	}
+	return bytecode, diagnostics
+}
+
+// hasErrors 判断诊断列表中是否有错误级别的诊断
+func hasErrors(diagnostics []Diagnostic) bool {
+	for _, d := range diagnostics {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
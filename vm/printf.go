@@ -0,0 +1,90 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// formatPrintf 按 C 语言 printf 的规则格式化输出
+// 支持 %d（整数）、%c（字符码点）、%f（浮点数）、%s（字符串）和 %%，
+// 转换说明可以带有左对齐标志、宽度和精度，如 %5d、%-5d、%.2f、%8.3f
+func formatPrintf(format string, args []interface{}) (string, error) {
+	var out strings.Builder
+	next := 0 // 下一个待使用的参数
+
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			out.WriteByte(format[i])
+			continue
+		}
+
+		// 读取可选的左对齐标志、宽度和精度，spec 保存 % 之后、动词之前的部分
+		start := i + 1
+		i = start
+		if i < len(format) && format[i] == '-' {
+			i++
+		}
+		for i < len(format) && isDigit(format[i]) {
+			i++
+		}
+		if i < len(format) && format[i] == '.' {
+			i++
+			for i < len(format) && isDigit(format[i]) {
+				i++
+			}
+		}
+		if i == len(format) {
+			return "", fmt.Errorf("printf: format ends with %%%s", format[start:])
+		}
+		spec, verb := format[start:i], format[i]
+		if verb == '%' && spec == "" {
+			out.WriteByte('%')
+			continue
+		}
+
+		if next == len(args) {
+			return "", fmt.Errorf("printf: too few arguments for %%%s%c", spec, verb)
+		}
+		arg := args[next]
+		next++
+
+		switch verb {
+		case 'd':
+			v, ok := arg.(int64)
+			if !ok {
+				return "", fmt.Errorf("printf: %%d expects an integer, got %T", arg)
+			}
+			fmt.Fprintf(&out, "%"+spec+"d", v)
+		case 'c':
+			v, ok := arg.(int64)
+			if !ok {
+				return "", fmt.Errorf("printf: %%c expects a character, got %T", arg)
+			}
+			fmt.Fprintf(&out, "%"+spec+"c", rune(v))
+		case 'f':
+			v, ok := arg.(float64)
+			if !ok {
+				return "", fmt.Errorf("printf: %%f expects a float, got %T", arg)
+			}
+			fmt.Fprintf(&out, "%"+spec+"f", v)
+		case 's':
+			v, ok := arg.(string)
+			if !ok {
+				return "", fmt.Errorf("printf: %%s expects a string, got %T", arg)
+			}
+			fmt.Fprintf(&out, "%"+spec+"s", v)
+		default:
+			return "", fmt.Errorf("printf: unknown verb %%%s%c", spec, verb)
+		}
+	}
+
+	if next < len(args) {
+		return "", fmt.Errorf("printf: too many arguments")
+	}
+	return out.String(), nil
+}
+
+// isDigit 判断字节是否为十进制数字
+func isDigit(ch byte) bool {
+	return '0' <= ch && ch <= '9'
+}
@@ -0,0 +1,25 @@
+package vm
+
+import "Butterfly/compiler"
+
+// Runner 用于批量执行大量字节码程序（例如批改作业）
+// 它持有一个可复用的虚拟机，每次运行只重置状态而不重新分配栈
+type Runner struct {
+	vm *VM
+}
+
+func NewRunner() *Runner {
+	return &Runner{vm: New(nil)}
+}
+
+// Run 执行一段字节码，返回最后弹出的值；程序没有弹出任何值时返回 nil
+// 每次运行前清空上一个程序留下的栈和全局变量
+func (r *Runner) Run(bytecode *compiler.Bytecode) (interface{}, error) {
+	r.vm.reset(bytecode)
+
+	err := r.vm.Run()
+	if err != nil {
+		return nil, err
+	}
+	return r.vm.LastPoppedStackElem(), nil
+}
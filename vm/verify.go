@@ -0,0 +1,56 @@
+package vm
+
+import (
+	"Butterfly/compiler"
+	"fmt"
+)
+
+// Verify 在执行前检查字节码的结构是否合法：
+// 每个操作码都已定义、操作数没有越过指令末尾、常量索引没有越界、
+// 跳转目标落在某条指令的起始位置（或指令序列末尾）、OpPrint 至少带有格式字符串。
+// 从外部加载（例如反序列化）的字节码在交给 VM 之前应先经过校验。
+func Verify(bc *compiler.Bytecode) error {
+	ins := bc.Instructions
+	starts := map[int]bool{len(ins): true} // 所有指令的起始偏移，跳转到末尾表示结束执行
+	jumps := [][2]int{}                    // 跳转指令的偏移及其跳转目标
+	ip := 0
+	for ip < len(ins) {
+		starts[ip] = true
+		op := compiler.Opcode(ins[ip])
+		def, err := compiler.Lookup(op)
+		if err != nil {
+			return fmt.Errorf("unknown opcode %d at offset %d", ins[ip], ip)
+		}
+
+		// 读取操作数，确认其完整地落在指令序列内
+		operands, read, ok := compiler.ReadOperands(def, ins[ip+1:])
+		if !ok {
+			return fmt.Errorf("truncated operand for %s at offset %d", op, ip)
+		}
+		offset := ip + 1 + read
+
+		if op == compiler.OpConstant && operands[0] >= len(bc.Constants) {
+			return fmt.Errorf("constant index %d out of range at offset %d", operands[0], ip)
+		}
+
+		// printf 的参数个数包括格式字符串，至少为 1
+		if op == compiler.OpPrint && operands[0] == 0 {
+			return fmt.Errorf("OpPrint without format string at offset %d", ip)
+		}
+
+		if op == compiler.OpJump || op == compiler.OpJumpNotTruthy {
+			jumps = append(jumps, [2]int{ip, operands[0]})
+		}
+
+		ip = offset
+	}
+
+	// 所有指令的边界确定之后才能检查跳转目标
+	for _, jump := range jumps {
+		offset, target := jump[0], jump[1]
+		if !starts[target] {
+			return fmt.Errorf("invalid jump target %d at offset %d", target, offset)
+		}
+	}
+	return nil
+}
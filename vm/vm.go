@@ -2,25 +2,104 @@ package vm
 
 import (
 	"Butterfly/compiler"
+	"context"
 	"fmt"
+	"io"
+	"math"
+	"os"
+	"reflect"
+	"strings"
 )
 
 const StackSize = 2048
 
+// RunContext 每执行这么多条指令检查一次 context 是否已取消，避免每条指令都检查的开销
+const contextCheckInterval = 1024
+
+// 全局变量槽位数，受 OpSetGlobal/OpGetGlobal 的2字节操作数限制
+const GlobalsSize = 65536
+
+// 字符串重复（如 "ab" * 3）结果的默认最大字节数，防止占用过多内存
+const DefaultMaxRepeatLength = 1 << 20
+
 type VM struct {
 	bytecode *compiler.Bytecode
 	stack    []interface{}
 	sp       int // 栈顶指针 (Stack Pointer)
+	globals  []interface{}
+	out      io.Writer // printf 的输出目标
+
+	globalsUsed int // 已写入过的全局变量槽位上界，重置时只需清空这一部分
+
+	denied          map[compiler.Opcode]bool // 沙箱模式下禁止执行的操作码
+	int32Mode       bool                     // 整数运算结果按32位回绕
+	maxRepeatLength int                      // 字符串重复结果的最大字节数
 }
 
 func New(bytecode *compiler.Bytecode) *VM {
+	return NewWithOutput(bytecode, os.Stdout)
+}
+
+// NewWithOutput 创建一个将 printf 输出写入 out 的虚拟机
+func NewWithOutput(bytecode *compiler.Bytecode, out io.Writer) *VM {
+	return NewWithGlobalsStore(bytecode, make([]interface{}, GlobalsSize), out)
+}
+
+// NewWithGlobalsStore 创建一个使用给定全局变量存储的虚拟机，
+// 交互模式中各行共享同一份存储，前面各行赋的值在后面的行中仍然可见
+// globals 的长度应为 GlobalsSize
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, globals []interface{}, out io.Writer) *VM {
 	return &VM{
 		bytecode: bytecode,
 		stack:    make([]interface{}, StackSize),
 		sp:       0,
+		globals:  globals,
+		out:      out,
+
+		maxRepeatLength: DefaultMaxRepeatLength,
+	}
+}
+
+// Deny 将指定操作码加入禁止列表，用于以沙箱方式运行不受信任的程序。
+// 执行到被禁止的操作码时 Run 返回错误。
+func (vm *VM) Deny(ops ...compiler.Opcode) {
+	if vm.denied == nil {
+		vm.denied = map[compiler.Opcode]bool{}
+	}
+	for _, op := range ops {
+		vm.denied[op] = true
 	}
 }
 
+// EnableInt32Mode 开启32位整数模式，整数运算和取负的结果按 int32 回绕，
+// 例如 2147483647 + 1 得到 -2147483648
+func (vm *VM) EnableInt32Mode() {
+	vm.int32Mode = true
+}
+
+// SetMaxRepeatLength 设置字符串重复结果的最大字节数，超过时运行出错
+func (vm *VM) SetMaxRepeatLength(n int) {
+	vm.maxRepeatLength = n
+}
+
+// wrapInt 在32位模式下将整数截断为 int32 的取值
+func (vm *VM) wrapInt(v int64) int64 {
+	if vm.int32Mode {
+		return int64(int32(v))
+	}
+	return v
+}
+
+// reset 清除上一次执行留下的栈和全局变量，并换上新的字节码
+// 栈需要整体清空，否则没有弹出任何值的程序会读到上一次的“最后弹出”元素
+func (vm *VM) reset(bytecode *compiler.Bytecode) {
+	vm.bytecode = bytecode
+	vm.sp = 0
+	clear(vm.stack)
+	clear(vm.globals[:vm.globalsUsed])
+	vm.globalsUsed = 0
+}
+
 func (vm *VM) pop() interface{} {
 	if vm.sp == 0 {
 		return nil
@@ -46,35 +125,332 @@ func (vm *VM) StackTop() interface{} {
 	return vm.stack[vm.sp-1]
 }
 
+// LastPoppedStackElem 返回最近一次被弹出的元素
+// 弹出只移动栈顶指针而不清除数据，因此该元素仍位于 sp 所指的位置；
+// 栈已满时 sp 越过末尾，没有可返回的元素
+func (vm *VM) LastPoppedStackElem() interface{} {
+	if vm.sp >= len(vm.stack) {
+		return nil
+	}
+	return vm.stack[vm.sp]
+}
+
+// runtimeError 为执行错误附加出错指令对应的源码行号
+func (vm *VM) runtimeError(offset int, err error) error {
+	if pos, ok := vm.bytecode.PositionAt(offset); ok {
+		return fmt.Errorf("runtime error at line %d: %w", pos.Line, err)
+	}
+	return fmt.Errorf("runtime error: %w", err)
+}
+
 func (vm *VM) Run() error {
-	ip := 0 // 指令指针
+	return vm.RunContext(context.Background())
+}
+
+// RunContext 与 Run 相同，但在 ctx 被取消或超时后停止执行并返回 ctx 的错误，
+// 用于限制死循环等长时间运行的程序
+func (vm *VM) RunContext(ctx context.Context) error {
+	ip := 0    // 指令指针
+	steps := 0 // 已执行的指令数
 	for ip < len(vm.bytecode.Instructions) {
+		start := ip // 当前指令的起始偏移，用于定位错误
 		op := compiler.Opcode(vm.bytecode.Instructions[ip])
 		ip++
 
+		steps++
+		if steps%contextCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return vm.runtimeError(start, err)
+			}
+		}
+
+		if vm.denied[op] {
+			return fmt.Errorf("opcode %s disabled in sandbox", op)
+		}
+
 		switch op {
 		case compiler.OpConstant:
-			constIndex := int(vm.bytecode.Instructions[ip])<<8 | int(vm.bytecode.Instructions[ip+1])
+			constIndex := int(compiler.ReadUint16(vm.bytecode.Instructions[ip:]))
 			ip += 2
 			err := vm.push(vm.bytecode.Constants[constIndex])
 			if err != nil {
-				return err
+				return vm.runtimeError(start, err)
+			}
+
+		case compiler.OpAdd, compiler.OpSub, compiler.OpMul, compiler.OpDiv, compiler.OpMod, compiler.OpPow:
+			err := vm.executeBinaryOperation(op)
+			if err != nil {
+				return vm.runtimeError(start, err)
+			}
+
+		case compiler.OpPop:
+			vm.pop()
+
+		case compiler.OpSetGlobal:
+			globalIndex := int(compiler.ReadUint16(vm.bytecode.Instructions[ip:]))
+			ip += 2
+			vm.globals[globalIndex] = vm.pop()
+			if globalIndex >= vm.globalsUsed {
+				vm.globalsUsed = globalIndex + 1
+			}
+
+		case compiler.OpGetGlobal:
+			globalIndex := int(compiler.ReadUint16(vm.bytecode.Instructions[ip:]))
+			ip += 2
+			err := vm.push(vm.globals[globalIndex])
+			if err != nil {
+				return vm.runtimeError(start, err)
+			}
+
+		case compiler.OpJump:
+			ip = int(compiler.ReadUint16(vm.bytecode.Instructions[ip:]))
+
+		case compiler.OpJumpNotTruthy:
+			target := int(compiler.ReadUint16(vm.bytecode.Instructions[ip:]))
+			ip += 2
+			if !isTruthy(vm.pop()) {
+				ip = target
+			}
+
+		case compiler.OpPrint:
+			numArgs := int(compiler.ReadUint8(vm.bytecode.Instructions[ip:]))
+			ip++
+			err := vm.executePrint(numArgs)
+			if err != nil {
+				return vm.runtimeError(start, err)
+			}
+
+		case compiler.OpTrue, compiler.OpFalse:
+			err := vm.push(op == compiler.OpTrue)
+			if err != nil {
+				return vm.runtimeError(start, err)
+			}
+
+		case compiler.OpBang:
+			err := vm.push(!isTruthy(vm.pop()))
+			if err != nil {
+				return vm.runtimeError(start, err)
 			}
 
-		case compiler.OpAdd, compiler.OpSub:
-			right := vm.pop().(int64)
-			left := vm.pop().(int64)
-			var result int64
-			if op == compiler.OpAdd {
-				result = left + right
-			} else {
-				result = left - right
+		case compiler.OpMinus:
+			err := vm.executeMinusOperator()
+			if err != nil {
+				return vm.runtimeError(start, err)
 			}
-			err := vm.push(result)
+
+		case compiler.OpEqual, compiler.OpNotEqual, compiler.OpGreaterThan, compiler.OpGreaterEqual:
+			err := vm.executeComparison(op)
 			if err != nil {
-				return err
+				return vm.runtimeError(start, err)
 			}
 		}
 	}
 	return nil
 }
+
+// executeBinaryOperation 弹出两个操作数执行算术运算并压入结果
+// 两个操作数都是整数时做整数运算；任一操作数为浮点数时，另一个整数被提升为浮点数；
+// 两个字符串只支持 + 拼接；字符串与整数相乘时重复该字符串
+func (vm *VM) executeBinaryOperation(op compiler.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	var result interface{}
+	var err error
+
+	leftInt, leftIsInt := left.(int64)
+	rightInt, rightIsInt := right.(int64)
+	leftFloat, leftIsNumber := toFloat(left)
+	rightFloat, rightIsNumber := toFloat(right)
+	leftStr, leftIsStr := left.(string)
+	rightStr, rightIsStr := right.(string)
+
+	switch {
+	case leftIsStr && rightIsStr && op == compiler.OpAdd:
+		result = leftStr + rightStr
+	case leftIsStr && rightIsInt && op == compiler.OpMul:
+		result, err = vm.repeatString(leftStr, rightInt)
+	case leftIsInt && rightIsStr && op == compiler.OpMul:
+		result, err = vm.repeatString(rightStr, leftInt)
+	case leftIsInt && rightIsInt:
+		var v int64
+		v, err = executeIntegerOperation(op, leftInt, rightInt)
+		result = vm.wrapInt(v)
+	case leftIsNumber && rightIsNumber:
+		result = executeFloatOperation(op, leftFloat, rightFloat)
+	default:
+		return fmt.Errorf("unsupported operand types for %s: %T and %T", op, left, right)
+	}
+	if err != nil {
+		return err
+	}
+	return vm.push(result)
+}
+
+// executePrint 弹出格式字符串及其后的 numArgs-1 个参数，格式化后写入输出
+func (vm *VM) executePrint(numArgs int) error {
+	if numArgs == 0 {
+		return fmt.Errorf("printf: missing format string")
+	}
+	args := make([]interface{}, numArgs)
+	for i := numArgs - 1; i >= 0; i-- {
+		args[i] = vm.pop()
+	}
+
+	format, ok := args[0].(string)
+	if !ok {
+		return fmt.Errorf("printf: format must be a string, got %T", args[0])
+	}
+	text, err := formatPrintf(format, args[1:])
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(vm.out, text)
+	return err
+}
+
+// repeatString 将字符串重复 count 次，次数为负或结果超过长度上限时返回错误
+func (vm *VM) repeatString(s string, count int64) (string, error) {
+	if count < 0 {
+		return "", fmt.Errorf("negative repeat count: %d", count)
+	}
+	if len(s) > 0 && count > int64(vm.maxRepeatLength/len(s)) {
+		return "", fmt.Errorf("repeated string too long: limit is %d bytes", vm.maxRepeatLength)
+	}
+	return strings.Repeat(s, int(count)), nil
+}
+
+// executeIntegerOperation 执行两个整数之间的算术运算
+func executeIntegerOperation(op compiler.Opcode, left, right int64) (int64, error) {
+	switch op {
+	case compiler.OpAdd:
+		return left + right, nil
+	case compiler.OpSub:
+		return left - right, nil
+	case compiler.OpMul:
+		return left * right, nil
+	case compiler.OpDiv:
+		if right == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		return left / right, nil
+	case compiler.OpMod:
+		if right == 0 {
+			return 0, fmt.Errorf("modulo by zero")
+		}
+		return left % right, nil
+	case compiler.OpPow:
+		if right < 0 {
+			return 0, fmt.Errorf("negative exponent: %d", right)
+		}
+		// 快速幂：按指数的二进制位逐次平方
+		var result int64 = 1
+		for base, exp := left, right; exp > 0; exp >>= 1 {
+			if exp&1 == 1 {
+				result *= base
+			}
+			base *= base
+		}
+		return result, nil
+	default:
+		return 0, fmt.Errorf("unknown integer operator: %s", op)
+	}
+}
+
+// executeFloatOperation 执行两个浮点数之间的算术运算
+func executeFloatOperation(op compiler.Opcode, left, right float64) float64 {
+	switch op {
+	case compiler.OpAdd:
+		return left + right
+	case compiler.OpSub:
+		return left - right
+	case compiler.OpMul:
+		return left * right
+	case compiler.OpDiv:
+		return left / right
+	case compiler.OpMod:
+		return math.Mod(left, right)
+	default: // compiler.OpPow
+		return math.Pow(left, right)
+	}
+}
+
+// executeMinusOperator 弹出一个数值并压入其相反数
+func (vm *VM) executeMinusOperator() error {
+	operand := vm.pop()
+	switch v := operand.(type) {
+	case int64:
+		return vm.push(vm.wrapInt(-v))
+	case float64:
+		return vm.push(-v)
+	default:
+		return fmt.Errorf("unsupported operand type for negation: %T", operand)
+	}
+}
+
+// executeComparison 弹出两个操作数进行比较并压入布尔结果
+// 数值之间按大小比较（整数与浮点数混合时提升为浮点数），其他同类型值只支持 == 和 !=
+func (vm *VM) executeComparison(op compiler.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	leftInt, leftIsInt := left.(int64)
+	rightInt, rightIsInt := right.(int64)
+	leftFloat, leftIsNumber := toFloat(left)
+	rightFloat, rightIsNumber := toFloat(right)
+
+	var result bool
+	switch {
+	case leftIsInt && rightIsInt:
+		result = compareOrdered(op, leftInt, rightInt)
+	case leftIsNumber && rightIsNumber:
+		result = compareOrdered(op, leftFloat, rightFloat)
+	case reflect.TypeOf(left) == reflect.TypeOf(right) && (op == compiler.OpEqual || op == compiler.OpNotEqual):
+		result = (left == right) == (op == compiler.OpEqual)
+	default:
+		return fmt.Errorf("unsupported operand types for %s: %T and %T", op, left, right)
+	}
+	return vm.push(result)
+}
+
+// compareOrdered 按比较操作码比较两个可排序的值
+func compareOrdered[T int64 | float64](op compiler.Opcode, left, right T) bool {
+	switch op {
+	case compiler.OpEqual:
+		return left == right
+	case compiler.OpNotEqual:
+		return left != right
+	case compiler.OpGreaterThan:
+		return left > right
+	default: // compiler.OpGreaterEqual
+		return left >= right
+	}
+}
+
+// isTruthy 判断值的真假：false、整数 0、浮点数 0 和 nil 为假，其余为真
+func isTruthy(obj interface{}) bool {
+	switch v := obj.(type) {
+	case bool:
+		return v
+	case int64:
+		return v != 0
+	case float64:
+		return v != 0
+	case nil:
+		return false
+	default:
+		return true
+	}
+}
+
+// toFloat 将数值操作数转换为 float64，非数值返回 false
+func toFloat(obj interface{}) (float64, bool) {
+	switch v := obj.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	default:
+		return 0, false
+	}
+}